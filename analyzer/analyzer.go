@@ -12,6 +12,8 @@ import (
 type gureAnalyzer struct {
 	internal.ModuleInternal
 	respParsers []module.ParseResponse
+	//解析前后执行的中间件
+	middlewares []module.AnalyzerMiddleware
 }
 
 func (g *gureAnalyzer) RespParsers() []module.ParseResponse {
@@ -39,7 +41,7 @@ func (g *gureAnalyzer) Analyze(resp *module.Response) (dataList []module.Data, e
 		return
 	}
 	request := httpRes.Request
-	if httpRes == nil {
+	if request == nil {
 		errorList = append(errorList, gerror.NewIllegalParameterError("nil request "))
 		return
 	}
@@ -56,12 +58,24 @@ func (g *gureAnalyzer) Analyze(resp *module.Response) (dataList []module.Data, e
 	if httpRes.Body != nil {
 		defer httpRes.Body.Close() //及时关闭链接
 	}
+	//任意中间件返回false时跳过解析
+	for _, middleware := range g.middlewares {
+		ok, err := middleware.BeforeParse(resp)
+		if err != nil {
+			errorList = append(errorList, err)
+		}
+		if !ok {
+			return nil, errorList
+		}
+	}
 	multipleReader, err := kits.NewMultipleReader(httpRes.Body)
 	if err != nil {
 		return nil, append(errorList, err)
 	}
 	//应当保证不为nil，提前准备部分缓冲区提高效率
-	dataList = make([]module.Data, len(g.respParsers))
+	dataList = make([]module.Data, 0, len(g.respParsers))
+	//重定向之后的最终链接，作为解析得到的请求的来源
+	parent := url.String()
 	for _, respParse := range g.RespParsers() {
 		httpRes.Body = multipleReader.Reader()                 //将数据流转换为新的readercloser，提供重复读取功能
 		parseList, errList := respParse(httpRes, resp.Depth()) //解析得到相关数据
@@ -70,6 +84,14 @@ func (g *gureAnalyzer) Analyze(resp *module.Response) (dataList []module.Data, e
 				if value == nil {
 					continue
 				}
+				if req, ok := value.(*module.Request); ok {
+					if req.Parent() == "" {
+						req.SetParent(parent)
+					}
+					if req.Session() == "" {
+						req.SetSession(resp.Session())
+					}
+				}
 				dataList = append(dataList, value) //添加到结果列表
 			}
 		}
@@ -78,10 +100,15 @@ func (g *gureAnalyzer) Analyze(resp *module.Response) (dataList []module.Data, e
 				if value == nil {
 					continue
 				}
-				errList = append(errorList, value) //添加到结果列表
+				errorList = append(errorList, value) //添加到结果列表
 			}
 		}
 	}
+	for i := len(g.middlewares) - 1; i >= 0; i-- {
+		var errList []error
+		dataList, errList = g.middlewares[i].AfterParse(resp, dataList)
+		errorList = append(errorList, errList...)
+	}
 	//完成解析，判断是否完全完成，不出现错误
 	if len(errorList) == 0 {
 		g.IncrCompletedCount()
@@ -90,7 +117,8 @@ func (g *gureAnalyzer) Analyze(resp *module.Response) (dataList []module.Data, e
 }
 
 //返回一个分析器，参数需要解析方法
-func New(mid module.MID, respParsers []module.ParseResponse, scoreCalculator module.CalculateScore) (module.Analyzer, error) {
+//middlewares 按照顺序在解析之前调用，按照相反的顺序在解析之后调用
+func New(mid module.MID, respParsers []module.ParseResponse, scoreCalculator module.CalculateScore, middlewares ...module.AnalyzerMiddleware) (module.Analyzer, error) {
 	moduleInternal, err := commom.NewModuleInternal(mid, scoreCalculator)
 	if err != nil {
 		return nil, err
@@ -109,9 +137,15 @@ func New(mid module.MID, respParsers []module.ParseResponse, scoreCalculator mod
 		}
 		innerParsers = append(innerParsers, f)
 	}
+	for _, middleware := range middlewares {
+		if middleware == nil {
+			return nil, gerror.NewIllegalParameterError("nil analyzer middleware")
+		}
+	}
 	return &gureAnalyzer{
 		ModuleInternal: moduleInternal,
 		respParsers:    innerParsers,
+		middlewares:    append([]module.AnalyzerMiddleware(nil), middlewares...),
 	}, nil
 
 }
@@ -0,0 +1,63 @@
+package analyzer
+
+import (
+	"Gure/module"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newResponse(contentType, body string) *module.Response {
+	httpReq, _ := http.NewRequest(http.MethodGet, "http://example.com/page", nil)
+	httpResp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {contentType}},
+		Body: io.NopCloser(strings.NewReader(body)), ContentLength: -1, Request: httpReq}
+	return module.NewResponse(httpResp, 1)
+}
+
+func TestAnalyzer_Middleware(t *testing.T) {
+	parser := func(resp *http.Response, depth uint32) ([]module.Data, []error) {
+		body, _ := io.ReadAll(resp.Body)
+		var dataList []module.Data
+		for _, link := range strings.Fields(string(body)) {
+			httpReq, _ := http.NewRequest(http.MethodGet, link, nil)
+			dataList = append(dataList, module.NewRequest(httpReq, depth+1))
+		}
+		return append(dataList, module.Item{"size": len(body)}), nil
+	}
+	//只保留同一站点的请求
+	sameSite := MiddlewareFuncs{After: func(resp *module.Response, dataList []module.Data) ([]module.Data, []error) {
+		var kept []module.Data
+		for _, data := range dataList {
+			if req, ok := data.(*module.Request); ok && req.HTTPRep().URL.Host != "example.com" {
+				continue
+			}
+			kept = append(kept, data)
+		}
+		return kept, nil
+	}}
+	ana, err := New("A|1|127.0.0.1:8080", []module.ParseResponse{parser}, nil,
+		AllowContentTypes("text/html"), MaxBodySize(64), sameSite, Provenance("_source"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataList, errList := ana.Analyze(newResponse("text/html; charset=utf-8", "http://example.com/a http://other.com/b"))
+	if len(errList) != 0 || len(dataList) != 2 {
+		t.Fatalf("got data %v errors %v", dataList, errList)
+	}
+	if req, ok := dataList[0].(*module.Request); !ok || req.HTTPRep().URL.Path != "/a" || req.Parent() != "http://example.com/page" {
+		t.Errorf("unexpected request %v", dataList[0])
+	}
+	item, ok := dataList[1].(module.Item)
+	if !ok || item["_source"].(map[string]interface{})["url"] != "http://example.com/page" {
+		t.Errorf("item should carry provenance, got %v", dataList[1])
+	}
+
+	if dataList, errList = ana.Analyze(newResponse("application/json", "{}")); len(dataList) != 0 || len(errList) != 0 {
+		t.Errorf("non-html response should be skipped, got %v %v", dataList, errList)
+	}
+	if _, errList = ana.Analyze(newResponse("text/html", strings.Repeat("x", 100))); len(errList) != 1 {
+		t.Errorf("huge body should be rejected, got %v", errList)
+	}
+}
@@ -0,0 +1,105 @@
+package analyzer
+
+import (
+	"Gure/module"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// MiddlewareFuncs 使用函数实现解析器中间件，为空的函数不做处理
+type MiddlewareFuncs struct {
+	//Before 解析之前调用，返回false时跳过解析
+	Before func(resp *module.Response) (bool, error)
+	//After 解析之后调用，返回过滤或者改写后的数据
+	After func(resp *module.Response, dataList []module.Data) ([]module.Data, []error)
+}
+
+func (m MiddlewareFuncs) BeforeParse(resp *module.Response) (bool, error) {
+	if m.Before == nil {
+		return true, nil
+	}
+	return m.Before(resp)
+}
+
+func (m MiddlewareFuncs) AfterParse(resp *module.Response, dataList []module.Data) ([]module.Data, []error) {
+	if m.After == nil {
+		return dataList, nil
+	}
+	return m.After(resp, dataList)
+}
+
+// AllowContentTypes 只解析指定媒体类型的响应，例如 text/html，没有Content-Type的响应照常解析
+func AllowContentTypes(types ...string) module.AnalyzerMiddleware {
+	allowed := make(map[string]bool, len(types))
+	for _, t := range types {
+		allowed[strings.ToLower(strings.TrimSpace(t))] = true
+	}
+	return MiddlewareFuncs{Before: func(resp *module.Response) (bool, error) {
+		contentType := resp.HTTPResp().Header.Get("Content-Type")
+		if contentType == "" {
+			return true, nil
+		}
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			mediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+		}
+		return allowed[strings.ToLower(mediaType)], nil
+	}}
+}
+
+// bodyTooLargeError 响应体超出大小限制
+var bodyTooLargeError = errors.New("response body too large")
+
+// limitedBody 读取超出限制时返回错误的响应体
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, bodyTooLargeError
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, bodyTooLargeError
+	}
+	return n, err
+}
+
+// MaxBodySize 拒绝响应体超过limit字节的响应，长度未知时在读取超出后报错
+func MaxBodySize(limit int64) module.AnalyzerMiddleware {
+	return MiddlewareFuncs{Before: func(resp *module.Response) (bool, error) {
+		httpResp := resp.HTTPResp()
+		if httpResp.ContentLength > limit {
+			return false, fmt.Errorf("response body of %s too large: %d bytes", httpResp.Request.URL, httpResp.ContentLength)
+		}
+		if httpResp.Body != nil {
+			httpResp.Body = &limitedBody{ReadCloser: httpResp.Body, remaining: limit}
+		}
+		return true, nil
+	}}
+}
+
+// Provenance 为解析得到的条目记录来源，key对应的值包括响应的链接与深度
+func Provenance(key string) module.AnalyzerMiddleware {
+	return MiddlewareFuncs{After: func(resp *module.Response, dataList []module.Data) ([]module.Data, []error) {
+		source := map[string]interface{}{
+			"url":   resp.HTTPResp().Request.URL.String(),
+			"depth": resp.Depth(),
+		}
+		for _, data := range dataList {
+			if item, ok := data.(module.Item); ok && item != nil {
+				item[key] = source
+			}
+		}
+		return dataList, nil
+	}}
+}
@@ -4,18 +4,13 @@ import (
 	"Gure/internal"
 	"Gure/module"
 	"fmt"
+	"sync/atomic"
 )
 
-//实现ModuleInternal，内嵌基本组件
+//实现ModuleInternal，内嵌基本组件，计数使用原子操作保证并发安全
 type gureModule struct {
-	//组件id
-	mid module.MID
-	//网络地址
-	addr string
-	//评分
+	//评分，原子操作的字段放在前面保证32位平台上的对齐
 	score uint64
-	//评分计算器
-	scoreCalculator module.CalculateScore
 	//被调用次数
 	calledCount uint64
 	//最多接收次数
@@ -24,77 +19,91 @@ type gureModule struct {
 	completedCount uint64
 	//正在处理的次数
 	handlingNumber uint64
+	//组件id
+	mid module.MID
+	//网络地址
+	addr string
+	//评分计算器
+	scoreCalculator module.CalculateScore
 }
 
-func (g gureModule) ID() module.MID {
+func (g *gureModule) ID() module.MID {
 	return g.mid
 }
 
-func (g gureModule) Addr() string {
+func (g *gureModule) Addr() string {
 	return g.addr
 }
 
-func (g gureModule) Score() uint64 {
-	return g.score
+func (g *gureModule) Score() uint64 {
+	return atomic.LoadUint64(&g.score)
 }
 
-func (g gureModule) SetScore(uint642 uint64) {
-	g.score = uint642
+func (g *gureModule) SetScore(uint642 uint64) {
+	atomic.StoreUint64(&g.score, uint642)
 }
 
-func (g gureModule) ScoreCalculator() module.CalculateScore {
+func (g *gureModule) ScoreCalculator() module.CalculateScore {
 	return g.scoreCalculator
 }
 
-func (g gureModule) CalledCount() uint64 {
-	return g.calledCount
+func (g *gureModule) CalledCount() uint64 {
+	return atomic.LoadUint64(&g.calledCount)
 }
 
-func (g gureModule) AcceptedCount() uint64 {
-	return g.acceptedCount
+func (g *gureModule) AcceptedCount() uint64 {
+	return atomic.LoadUint64(&g.acceptedCount)
 }
 
-func (g gureModule) CompletedCount() uint64 {
-	return g.completedCount
+func (g *gureModule) CompletedCount() uint64 {
+	return atomic.LoadUint64(&g.completedCount)
 }
 
-func (g gureModule) HandlingNumber() uint64 {
-	return g.handlingNumber
+func (g *gureModule) HandlingNumber() uint64 {
+	return atomic.LoadUint64(&g.handlingNumber)
 }
 
-func (g gureModule) Counts() module.Counts {
-	return g.Counts()
+func (g *gureModule) Counts() module.Counts {
+	return module.Counts{
+		Called:    g.CalledCount(),
+		Accepted:  g.AcceptedCount(),
+		Completed: g.CompletedCount(),
+		Handling:  g.HandlingNumber(),
+	}
 }
 
-func (g gureModule) Summary() module.SummaryStruct {
-	return g.Summary()
+func (g *gureModule) Summary() module.SummaryStruct {
+	return module.SummaryStruct{
+		ID:     g.mid,
+		Counts: g.Counts(),
+	}
 }
 
-func (g gureModule) IncrCalledCount() {
-	g.calledCount++
+func (g *gureModule) IncrCalledCount() {
+	atomic.AddUint64(&g.calledCount, 1)
 }
 
-func (g gureModule) IncrAcceptedCount() {
-	g.acceptedCount++
+func (g *gureModule) IncrAcceptedCount() {
+	atomic.AddUint64(&g.acceptedCount, 1)
 }
 
-func (g gureModule) IncrCompletedCount() {
-	g.completedCount++
+func (g *gureModule) IncrCompletedCount() {
+	atomic.AddUint64(&g.completedCount, 1)
 }
 
-func (g gureModule) IncrHandlingNumber() {
-	g.handlingNumber++
+func (g *gureModule) IncrHandlingNumber() {
+	atomic.AddUint64(&g.handlingNumber, 1)
 }
 
-func (g gureModule) DecrHandlingNumber() {
-	g.handlingNumber--
+func (g *gureModule) DecrHandlingNumber() {
+	atomic.AddUint64(&g.handlingNumber, ^uint64(0))
 }
 
-func (g gureModule) Clear() {
-	g.acceptedCount = 0
-	g.completedCount = 0
-	g.calledCount = 0
-	g.handlingNumber = 0
+func (g *gureModule) Clear() {
+	atomic.StoreUint64(&g.acceptedCount, 0)
+	atomic.StoreUint64(&g.completedCount, 0)
+	atomic.StoreUint64(&g.calledCount, 0)
+	atomic.StoreUint64(&g.handlingNumber, 0)
 }
 
 func NewModuleInternal(mid module.MID, scoreCalculator module.CalculateScore) (internal.ModuleInternal, error) {
@@ -0,0 +1,145 @@
+package deadletter
+
+import (
+	"Gure/gerror"
+	"Gure/module"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Letter 一条死信，记录永久失败的请求或者条目以及导致失败的错误
+type Letter struct {
+	//Time 失败的时间
+	Time time.Time `json:"time"`
+	//ErrType 错误出现的模块
+	ErrType module.ErrorType `json:"errType"`
+	//ErrMsg 错误信息
+	ErrMsg string `json:"errMsg"`
+	//Request 失败的请求，与Item只有一个不为空
+	Request *module.RequestRecord `json:"request,omitempty"`
+	//Item 处理失败的条目
+	Item module.Item `json:"item,omitempty"`
+}
+
+// NewRequestLetter 为下载失败的请求生成死信
+func NewRequestLetter(req *module.Request, err gerror.SpiderError) Letter {
+	record := req.Record()
+	return Letter{
+		Time:    time.Now(),
+		ErrType: err.Type(),
+		ErrMsg:  err.Msg(),
+		Request: &record,
+	}
+}
+
+// NewItemLetter 为处理失败的条目生成死信
+func NewItemLetter(item module.Item, err gerror.SpiderError) Letter {
+	return Letter{
+		Time:    time.Now(),
+		ErrType: err.Type(),
+		ErrMsg:  err.Msg(),
+		Item:    item,
+	}
+}
+
+// Error 还原导致失败的错误
+func (l Letter) Error() gerror.SpiderError {
+	return gerror.NewSpiderError(l.ErrType, l.ErrMsg)
+}
+
+// Store 死信存储，要求并发安全
+type Store interface {
+	// Put 保存一条死信
+	Put(letter Letter) error
+	// Count 返回保存的死信数量
+	Count() uint64
+	// Close 关闭存储
+	Close() error
+}
+
+// fileStore 以JSONL格式追加写入文件的死信存储
+type fileStore struct {
+	//写入锁
+	lock sync.Mutex
+	//死信文件
+	file *os.File
+	//写入计数
+	count uint64
+}
+
+func (f *fileStore) Put(letter Letter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("marshal dead letter fail with %v", err)
+	}
+	data = append(data, '\n')
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return fmt.Errorf("dead letter store is closed")
+	}
+	//一次写入整行，避免进程退出时留下半行
+	if _, err = f.file.Write(data); err != nil {
+		return fmt.Errorf("write dead letter fail with %v", err)
+	}
+	f.count++
+	return nil
+}
+
+func (f *fileStore) Count() uint64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.count
+}
+
+func (f *fileStore) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// NewFileStore 创建追加写入path的死信存储，文件不存在时会被创建
+func NewFileStore(path string) (Store, error) {
+	if path == "" {
+		return nil, gerror.NewIllegalParameterError("empty dead letter path")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open dead letter file fail with %v", err)
+	}
+	return &fileStore{file: file}, nil
+}
+
+// Read 从JSONL格式的数据中读取所有死信
+func Read(r io.Reader) ([]Letter, error) {
+	if r == nil {
+		return nil, gerror.NewIllegalParameterError("nil reader")
+	}
+	var letters []Letter
+	scanner := bufio.NewScanner(r)
+	//请求体与条目可能较大
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var letter Letter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			return letters, fmt.Errorf("decode dead letter at line %d fail with %v", line, err)
+		}
+		letters = append(letters, letter)
+	}
+	return letters, scanner.Err()
+}
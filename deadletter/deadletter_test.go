@@ -0,0 +1,59 @@
+package deadletter
+
+import (
+	"Gure/gerror"
+	"Gure/module"
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq, _ := http.NewRequest(http.MethodPost, "http://example.com/search", bytes.NewReader([]byte("q=gure")))
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	spiderErr := gerror.NewSpiderError(module.DownloaderError, "timeout")
+	if err = store.Put(NewRequestLetter(module.NewRequest(httpReq, 2), spiderErr)); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Put(NewItemLetter(module.Item{"title": "gure"}, spiderErr)); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	letters, err := Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 2 {
+		t.Fatalf("expect 2 letters, got %d", len(letters))
+	}
+	if letters[0].Error().Error() != spiderErr.Error() {
+		t.Errorf("error %q, want %q", letters[0].Error(), spiderErr)
+	}
+	req, err := letters[0].Request.Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := req.Record()
+	if record.Method != http.MethodPost || string(record.Body) != "q=gure" || record.Depth != 2 ||
+		req.HTTPRep().Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("request not restored %+v", record)
+	}
+	if letters[1].Item["title"] != "gure" {
+		t.Errorf("item not restored %v", letters[1].Item)
+	}
+}
@@ -0,0 +1,542 @@
+package downloader
+
+import (
+	"Gure/gerror"
+	"Gure/module"
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultMaxEntrySize 默认的单个缓存条目的最大响应体大小，超出的响应不会被缓存
+	DefaultMaxEntrySize = 32 << 20
+	// CacheStatusHeader 从缓存返回的响应会带上该响应头，与 module.CacheStatusHeader 相同
+	CacheStatusHeader = module.CacheStatusHeader
+	// CacheHit 响应直接从缓存中读取
+	CacheHit = module.CacheHit
+	// CacheRevalidated 缓存经过条件请求确认仍然有效
+	CacheRevalidated = module.CacheRevalidated
+	// heuristicFraction 只有Last-Modified时，新鲜期取距离上次修改时间的比例
+	heuristicFraction = 10
+)
+
+// cacheableStatus 默认可以缓存的状态码
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// HTTPCache 基于磁盘的HTTP缓存，可以作为http.Client的Transport或者下载器中间件使用
+// 按照Cache-Control、Expires判断缓存是否新鲜，过期后使用ETag、Last-Modified发送条件请求重新验证
+// 作为中间件使用时不同会话的响应分开缓存，带有Cookie或者Authorization的请求不使用缓存
+type HTTPCache interface {
+	http.RoundTripper
+	module.DownloaderMiddleware
+	SummaryReporter
+
+	// Stats 缓存的命中情况
+	Stats() CacheStats
+
+	// Clear 删除所有缓存
+	Clear() error
+}
+
+// CacheConfig 缓存设置
+type CacheConfig struct {
+	//Dir 缓存目录
+	Dir string
+	//DevMode 开发模式，忽略响应头缓存所有GET请求的响应，命中后不再访问网络，用于离线、可重复的调试
+	DevMode bool
+	//Transport 实际发送请求的Transport，默认为http.DefaultTransport
+	Transport http.RoundTripper
+	//MaxEntrySize 单个响应体的最大缓存大小，默认为DefaultMaxEntrySize
+	MaxEntrySize int64
+}
+
+// CacheStats 缓存的命中情况
+type CacheStats struct {
+	//Hits 直接从缓存返回的次数
+	Hits uint64 `json:"hits"`
+	//Revalidated 经过条件请求确认有效后从缓存返回的次数
+	Revalidated uint64 `json:"revalidated"`
+	//Misses 访问网络获取响应的次数
+	Misses uint64 `json:"misses"`
+}
+
+// cacheEntry 缓存条目的元数据，与响应体保存在同一个文件中
+type cacheEntry struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	//Vary 中列出的请求头及其取值
+	VaryHeader http.Header `json:"varyHeader,omitempty"`
+	//发送请求与收到响应的时间，用于计算缓存的年龄
+	RequestTime  time.Time `json:"requestTime"`
+	ResponseTime time.Time `json:"responseTime"`
+}
+
+// cachePending 作为中间件使用时，等待响应的请求对应的缓存条目
+type cachePending struct {
+	key         string
+	entry       *cacheEntry
+	body        []byte
+	validated   bool
+	requestTime time.Time
+	//为条件请求添加的请求头，请求完成后删除
+	added []string
+}
+
+type gureCache struct {
+	hits         uint64
+	revalidated  uint64
+	misses       uint64
+	dir          string
+	devMode      bool
+	transport    http.RoundTripper
+	maxEntrySize int64
+	//作为中间件使用时，以http请求为键保存等待响应的请求
+	pending sync.Map
+}
+
+// NewHTTPCache 创建基于磁盘的HTTP缓存
+func NewHTTPCache(config CacheConfig) (HTTPCache, error) {
+	if config.Dir == "" {
+		return nil, gerror.NewIllegalParameterError("empty cache dir")
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("create cache dir fail with %v", err)
+	}
+	c := &gureCache{
+		dir:          config.Dir,
+		devMode:      config.DevMode,
+		transport:    config.Transport,
+		maxEntrySize: config.MaxEntrySize,
+	}
+	if c.transport == nil {
+		c.transport = http.DefaultTransport
+	}
+	if c.maxEntrySize <= 0 {
+		c.maxEntrySize = DefaultMaxEntrySize
+	}
+	return c, nil
+}
+
+func (c *gureCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:        atomic.LoadUint64(&c.hits),
+		Revalidated: atomic.LoadUint64(&c.revalidated),
+		Misses:      atomic.LoadUint64(&c.misses),
+	}
+}
+
+func (c *gureCache) SummaryExtra() (string, interface{}) {
+	return "cache", c.Stats()
+}
+
+func (c *gureCache) Clear() error {
+	if err := os.RemoveAll(c.dir); err != nil {
+		return err
+	}
+	return os.MkdirAll(c.dir, 0755)
+}
+
+func (c *gureCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !c.cacheable(req) {
+		return c.transport.RoundTrip(req)
+	}
+	key, entry, body, usable := c.lookup(req, "")
+	if usable {
+		atomic.AddUint64(&c.hits, 1)
+		return entry.response(req, body, CacheHit), nil
+	}
+	//过期后使用验证器发送条件请求，不修改调用方的请求
+	outReq := req
+	if entry != nil && entry.validators() {
+		outReq = req.Clone(req.Context())
+		entry.conditional(outReq.Header)
+	}
+	requestTime := time.Now()
+	resp, err := c.transport.RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+	return c.finish(req, key, entry, body, outReq != req, resp, requestTime)
+}
+
+// ProcessRequest 作为下载器中间件使用时，缓存新鲜时直接返回缓存的响应，过期时为请求设置验证器
+func (c *gureCache) ProcessRequest(req *module.Request) (*module.Response, error) {
+	httpReq := req.HTTPRep()
+	if !c.cacheable(httpReq) {
+		return nil, nil
+	}
+	key, entry, body, usable := c.lookup(httpReq, req.Session())
+	if usable {
+		atomic.AddUint64(&c.hits, 1)
+		return module.NewResponse(entry.response(httpReq, body, CacheHit), req.Depth()), nil
+	}
+	p := &cachePending{key: key, entry: entry, body: body, requestTime: time.Now()}
+	if p.validated = entry != nil && entry.validators(); p.validated {
+		p.added = entry.conditional(httpReq.Header)
+	}
+	c.pending.Store(httpReq, p)
+	return nil, nil
+}
+
+// release 删除等待响应的请求，并且去掉为条件请求添加的请求头，避免请求重试时带上过期的验证器
+func (c *gureCache) release(req *module.Request) (*cachePending, bool) {
+	value, ok := c.pending.LoadAndDelete(req.HTTPRep())
+	if !ok {
+		return nil, false
+	}
+	p := value.(*cachePending)
+	for _, name := range p.added {
+		req.HTTPRep().Header.Del(name)
+	}
+	return p, true
+}
+
+// ProcessResponse 作为下载器中间件使用时，验证通过后返回缓存的响应，可以缓存时写入缓存
+func (c *gureCache) ProcessResponse(req *module.Request, resp *module.Response) (*module.Response, error) {
+	p, ok := c.release(req)
+	if !ok {
+		return resp, nil
+	}
+	httpResp, err := c.finish(req.HTTPRep(), p.key, p.entry, p.body, p.validated, resp.HTTPResp(), p.requestTime)
+	if err != nil {
+		return nil, err
+	}
+	return module.NewResponse(httpResp, resp.Depth()), nil
+}
+
+func (c *gureCache) ProcessError(req *module.Request, err error) (*module.Response, error) {
+	c.release(req)
+	return nil, err
+}
+
+// cacheable 判断请求是否使用缓存，只缓存GET请求
+//带有Cookie或者Authorization的请求得到的通常是私有的响应，不使用缓存
+func (c *gureCache) cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Cookie") != "" || req.Header.Get("Authorization") != "" {
+		return false
+	}
+	_, noStore := parseCacheControl(req.Header)["no-store"]
+	return c.devMode || !noStore
+}
+
+// lookup 查找请求在会话中对应的缓存条目，usable为true表示可以直接使用
+func (c *gureCache) lookup(req *http.Request, session string) (key string, entry *cacheEntry, body []byte, usable bool) {
+	key = cacheKey(req, session)
+	entry, body, err := c.load(key)
+	if err != nil || !entry.matches(req) {
+		return key, nil, nil, false
+	}
+	usable = c.devMode || entry.fresh(time.Now()) && !parseCacheControl(req.Header).forcesRevalidation()
+	return key, entry, body, usable
+}
+
+// finish 处理网络返回的响应，验证通过时更新并返回缓存的响应，可以缓存时写入缓存
+func (c *gureCache) finish(req *http.Request, key string, entry *cacheEntry, body []byte, validated bool,
+	resp *http.Response, requestTime time.Time) (*http.Response, error) {
+	responseTime := time.Now()
+	if resp.StatusCode == http.StatusNotModified && entry != nil && validated {
+		//缓存仍然有效，使用新的响应头更新缓存
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		for name, values := range resp.Header {
+			if name != "Content-Length" {
+				entry.Header[name] = values
+			}
+		}
+		entry.RequestTime, entry.ResponseTime = requestTime, responseTime
+		if err := c.save(key, entry, body); err != nil {
+			return nil, err
+		}
+		atomic.AddUint64(&c.revalidated, 1)
+		return entry.response(req, body, CacheRevalidated), nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+	if !c.devMode && !storable(req, resp) {
+		if entry != nil {
+			os.Remove(c.path(key))
+		}
+		return resp, nil
+	}
+	//读取完整的响应体后写入缓存，超出大小的响应原样返回
+	b, err := io.ReadAll(io.LimitReader(resp.Body, c.maxEntrySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(b)) > c.maxEntrySize {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	entry = &cacheEntry{
+		URL:          req.URL.String(),
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		VaryHeader:   varyHeader(req, resp),
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+	if err = c.save(key, entry, b); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// cacheKey 缓存的键，由请求方法、链接以及请求所属的会话计算，不同会话的响应分开缓存
+func cacheKey(req *http.Request, session string) string {
+	raw := req.Method + " " + req.URL.String()
+	if session != "" {
+		raw += " " + session
+	}
+	sum := sha1.Sum([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *gureCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// load 读取缓存条目，文件第一行为元数据，之后为响应体
+func (c *gureCache) load(key string) (*cacheEntry, []byte, error) {
+	file, err := os.Open(c.path(key))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, nil, err
+	}
+	var entry cacheEntry
+	if err = json.Unmarshal(line, &entry); err != nil {
+		return nil, nil, err
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &entry, body, nil
+}
+
+// save 写入缓存条目，先写入临时文件再替换，避免读取到写了一半的条目
+func (c *gureCache) save(key string, entry *cacheEntry, body []byte) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(meta, '\n'))
+	if err == nil {
+		_, err = tmp.Write(body)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write cache entry fail with %v", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// matches 判断请求中Vary列出的请求头是否与缓存时相同
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for name, values := range e.VaryHeader {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// validators 判断缓存条目是否有验证器
+func (e *cacheEntry) validators() bool {
+	return e.Header.Get("Etag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// conditional 为条件请求设置验证器，不覆盖已有的请求头，返回添加的请求头
+func (e *cacheEntry) conditional(header http.Header) (added []string) {
+	if etag := e.Header.Get("Etag"); etag != "" && header.Get("If-None-Match") == "" {
+		header.Set("If-None-Match", etag)
+		added = append(added, "If-None-Match")
+	}
+	if lastModified := e.Header.Get("Last-Modified"); lastModified != "" && header.Get("If-Modified-Since") == "" {
+		header.Set("If-Modified-Since", lastModified)
+		added = append(added, "If-Modified-Since")
+	}
+	return added
+}
+
+// fresh 判断缓存是否仍然新鲜
+func (e *cacheEntry) fresh(now time.Time) bool {
+	control := parseCacheControl(e.Header)
+	if _, ok := control["no-cache"]; ok {
+		return false
+	}
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		date = e.ResponseTime
+	}
+	//新鲜期依次取max-age、Expires，只有Last-Modified时按照比例估算
+	var lifetime time.Duration
+	if maxAge, ok := control.seconds("max-age"); ok {
+		lifetime = maxAge
+	} else if expires := e.Header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			lifetime = t.Sub(date)
+		}
+	} else if t, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && date.After(t) {
+		lifetime = date.Sub(t) / heuristicFraction
+	}
+	//缓存的年龄包括服务端给出的Age、传输时间以及保存后经过的时间
+	age := e.ResponseTime.Sub(date)
+	if age < 0 {
+		age = 0
+	}
+	if seconds, err := strconv.Atoi(e.Header.Get("Age")); err == nil && seconds > 0 {
+		if corrected := time.Duration(seconds)*time.Second + e.ResponseTime.Sub(e.RequestTime); corrected > age {
+			age = corrected
+		}
+	}
+	age += now.Sub(e.ResponseTime)
+	return lifetime > age
+}
+
+// response 使用缓存条目构造响应
+func (e *cacheEntry) response(req *http.Request, body []byte, status string) *http.Response {
+	header := e.Header.Clone()
+	header.Set(CacheStatusHeader, status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// storable 判断响应是否可以缓存，需要有新鲜期或者验证器
+func storable(req *http.Request, resp *http.Response) bool {
+	if !cacheableStatus[resp.StatusCode] {
+		return false
+	}
+	if _, ok := parseCacheControl(req.Header)["no-store"]; ok {
+		return false
+	}
+	control := parseCacheControl(resp.Header)
+	if _, ok := control["no-store"]; ok {
+		return false
+	}
+	for _, vary := range resp.Header.Values("Vary") {
+		if strings.TrimSpace(vary) == "*" {
+			return false
+		}
+	}
+	if _, ok := control["max-age"]; ok {
+		return true
+	}
+	if _, ok := control["no-cache"]; ok {
+		return true
+	}
+	for _, name := range []string{"Expires", "Etag", "Last-Modified"} {
+		if resp.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// varyHeader 记录响应的Vary中列出的请求头
+func varyHeader(req *http.Request, resp *http.Response) http.Header {
+	header := http.Header{}
+	for _, vary := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+			}
+		}
+	}
+	return header
+}
+
+// cacheControl 解析后的Cache-Control指令，键为小写的指令名
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	control := cacheControl{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, arg, _ := strings.Cut(directive, "=")
+			control[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+		}
+	}
+	return control
+}
+
+// seconds 读取以秒为单位的指令
+func (c cacheControl) seconds(name string) (time.Duration, bool) {
+	value, ok := c[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, true
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// forcesRevalidation 请求要求不使用未经验证的缓存
+func (c cacheControl) forcesRevalidation() bool {
+	if _, ok := c["no-cache"]; ok {
+		return true
+	}
+	maxAge, ok := c.seconds("max-age")
+	return ok && maxAge == 0
+}
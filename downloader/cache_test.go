@@ -0,0 +1,158 @@
+package downloader
+
+import (
+	"Gure/module"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// dropMiddleware 丢弃带有X-Drop请求头的请求
+type dropMiddleware struct{}
+
+func (dropMiddleware) ProcessRequest(req *module.Request) (*module.Response, error) {
+	if req.HTTPRep().Header.Get("X-Drop") != "" {
+		return nil, module.ErrRequestDropped
+	}
+	return nil, nil
+}
+
+func (dropMiddleware) ProcessResponse(req *module.Request, resp *module.Response) (*module.Response, error) {
+	return resp, nil
+}
+
+func (dropMiddleware) ProcessError(req *module.Request, err error) (*module.Response, error) {
+	return nil, err
+}
+
+func TestHTTPCache(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		io.WriteString(w, "body "+r.URL.Path)
+	}))
+	defer server.Close()
+
+	get := func(client *http.Client, path string) (string, string) {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.Header.Get(CacheStatusHeader)
+	}
+	cache, err := NewHTTPCache(CacheConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: cache}
+	cases := []struct {
+		path, status string
+		calls        int64
+	}{
+		{"/fresh", "", 1},
+		{"/fresh", CacheHit, 1},
+		{"/etag", "", 2},
+		{"/etag", CacheRevalidated, 3},
+		{"/nostore", "", 4},
+		{"/nostore", "", 5},
+	}
+	for _, c := range cases {
+		body, status := get(client, c.path)
+		if body != "body "+c.path || status != c.status || atomic.LoadInt64(&calls) != c.calls {
+			t.Errorf("%s: got %q status %q calls %d, want status %q calls %d", c.path, body, status, calls, c.status, c.calls)
+		}
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Revalidated != 1 || stats.Misses != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	//作为下载器中间件使用
+	middleware, _ := NewHTTPCache(CacheConfig{Dir: t.TempDir()})
+	loader, err := New("D|1|127.0.0.1:8080", &http.Client{}, nil, middleware)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"", CacheHit} {
+		httpReq, _ := http.NewRequest(http.MethodGet, server.URL+"/fresh", nil)
+		resp, err := loader.Download(module.NewRequest(httpReq, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.HTTPResp().Body)
+		if string(body) != "body /fresh" || resp.HTTPResp().Header.Get(CacheStatusHeader) != want {
+			t.Errorf("middleware got %q status %q, want %q", body, resp.HTTPResp().Header.Get(CacheStatusHeader), want)
+		}
+	}
+
+	//不同会话的响应分开缓存，带有凭据的请求不使用缓存
+	for _, c := range []struct{ session, cookie, status string }{
+		{"a", "", ""}, {"a", "", CacheHit}, {"b", "", ""}, {"", "id=1", ""}, {"", "id=1", ""},
+	} {
+		httpReq, _ := http.NewRequest(http.MethodGet, server.URL+"/fresh", nil)
+		if c.cookie != "" {
+			httpReq.Header.Set("Cookie", c.cookie)
+		}
+		request := module.NewRequest(httpReq, 0)
+		request.SetSession(c.session)
+		resp, err := loader.Download(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.HTTPResp().Body.Close()
+		if status := resp.HTTPResp().Header.Get(CacheStatusHeader); status != c.status {
+			t.Errorf("session %q cookie %q got status %q, want %q", c.session, c.cookie, status, c.status)
+		}
+	}
+
+	//之后的中间件丢弃请求时，缓存清理等待响应的请求与添加的验证器
+	dropCache, _ := NewHTTPCache(CacheConfig{Dir: t.TempDir()})
+	loader, _ = New("D|1|127.0.0.1:8080", &http.Client{}, nil, dropCache, dropMiddleware{})
+	for _, drop := range []bool{false, true} {
+		httpReq, _ := http.NewRequest(http.MethodGet, server.URL+"/etag", nil)
+		if drop {
+			httpReq.Header.Set("X-Drop", "1")
+		}
+		resp, err := loader.Download(module.NewRequest(httpReq, 0))
+		if !drop {
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.HTTPResp().Body.Close()
+			continue
+		}
+		if !errors.Is(err, module.ErrRequestDropped) || httpReq.Header.Get("If-None-Match") != "" {
+			t.Errorf("dropped request got err %v, header %v", err, httpReq.Header)
+		}
+	}
+	dropCache.(*gureCache).pending.Range(func(key, value any) bool {
+		t.Errorf("pending request leaked after drop")
+		return false
+	})
+
+	//开发模式缓存所有响应，服务端关闭后仍然可以读取
+	dev, _ := NewHTTPCache(CacheConfig{Dir: t.TempDir(), DevMode: true})
+	client = &http.Client{Transport: dev}
+	get(client, "/nostore")
+	server.Close()
+	if body, status := get(client, "/nostore"); body != "body /nostore" || status != CacheHit {
+		t.Errorf("dev mode should serve from cache, got %q %q", body, status)
+	}
+}
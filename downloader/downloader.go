@@ -5,6 +5,7 @@ import (
 	"Gure/gerror"
 	"Gure/internal"
 	"Gure/module"
+	"errors"
 	"log"
 	"net/http"
 )
@@ -13,6 +14,10 @@ import (
 type gureDownloader struct {
 	internal.ModuleInternal             //基础方法交给基础实例去实现即可
 	httpClient              http.Client //http客户端提供下载方法
+	//按照顺序执行的中间件
+	middlewares []module.DownloaderMiddleware
+	//调度器管理的Cookie存储，为nil时使用http客户端自带的Jar
+	cookieJars module.CookieJars
 }
 
 func (g *gureDownloader) Download(req *module.Request) (*module.Response, error) {
@@ -29,18 +34,102 @@ func (g *gureDownloader) Download(req *module.Request) (*module.Response, error)
 	}
 	//允许开始工作
 	g.IncrAcceptedCount()
-	log.Printf("Do DownLoader : URL %s Depth %d ...\n", httpReq.URL, req.Depth())
-	res, err := g.httpClient.Do(httpReq)
+	resp, err := g.process(req, 0)
 	if err != nil {
 		return nil, err
 	}
+	if resp == nil || resp.HTTPResp() == nil {
+		return nil, errors.New("nil response from downloader middleware")
+	}
 	g.IncrCompletedCount()
+	return resp, nil
+}
+
+// process 依次执行第i个及之后的中间件，最内层发送请求
+//中间件返回响应或者错误时不再向内传递，结果由外层的中间件按照相反的顺序处理
+//请求被丢弃时外层的中间件同样通过ProcessError清理状态，但是不能恢复被丢弃的请求
+func (g *gureDownloader) process(req *module.Request, i int) (*module.Response, error) {
+	if i == len(g.middlewares) {
+		return g.fetch(req)
+	}
+	middleware := g.middlewares[i]
+	resp, err := middleware.ProcessRequest(req)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	resp, err = g.process(req, i+1)
+	if errors.Is(err, module.ErrRequestDropped) {
+		recovered, _ := middleware.ProcessError(req, err)
+		if recovered != nil && recovered.HTTPResp() != nil && recovered.HTTPResp().Body != nil {
+			recovered.HTTPResp().Body.Close()
+		}
+		return nil, err
+	}
+	if err != nil {
+		recovered, newErr := middleware.ProcessError(req, err)
+		if recovered == nil && newErr == nil {
+			newErr = err
+		}
+		return recovered, newErr
+	}
+	processed, err := middleware.ProcessResponse(req, resp)
+	if processed == nil && err == nil {
+		processed = resp
+	}
+	return processed, err
+}
+
+// fetch 使用http客户端发送请求
+func (g *gureDownloader) fetch(req *module.Request) (*module.Response, error) {
+	httpReq := req.HTTPRep()
+	log.Printf("Do DownLoader : URL %s Depth %d ...\n", httpReq.URL, req.Depth())
+	client := g.httpClient
+	//按照请求所属的会话使用对应的Cookie存储，重定向时同样会读写Cookie
+	if g.cookieJars != nil {
+		client.Jar = g.cookieJars.Jar(req.Session())
+	}
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
 	return module.NewResponse(res, req.Depth()), nil
 }
 
+// SetCookieJars 使用调度器管理的Cookie存储，需要在开始下载之前调用
+func (g *gureDownloader) SetCookieJars(jars module.CookieJars) {
+	g.cookieJars = jars
+}
+
+// SummaryReporter 为下载器摘要提供额外信息
+//http客户端的Transport或者中间件实现该接口时，返回的信息以name为键出现在Summary().Extra中
+type SummaryReporter interface {
+	SummaryExtra() (name string, extra interface{})
+}
+
+// Summary 在基础摘要之外附带Transport与中间件的额外信息
+func (g *gureDownloader) Summary() module.SummaryStruct {
+	summary := g.ModuleInternal.Summary()
+	extra := map[string]interface{}{}
+	if reporter, ok := g.httpClient.Transport.(SummaryReporter); ok {
+		name, value := reporter.SummaryExtra()
+		extra[name] = value
+	}
+	for _, middleware := range g.middlewares {
+		if reporter, ok := middleware.(SummaryReporter); ok {
+			name, value := reporter.SummaryExtra()
+			extra[name] = value
+		}
+	}
+	if len(extra) > 0 {
+		summary.Extra = extra
+	}
+	return summary
+}
+
 // New 应该返回接口类型，为扩展做好准备
 //命名技巧，当独占一个包的时候可以省略表示名
-func New(mid module.MID, client *http.Client, scoreCalculator module.CalculateScore) (module.DownLoader, error) {
+//middlewares 按照顺序处理请求，按照相反的顺序处理响应与错误
+func New(mid module.MID, client *http.Client, scoreCalculator module.CalculateScore, middlewares ...module.DownloaderMiddleware) (module.DownLoader, error) {
 	moduleInternal, err := commom.NewModuleInternal(mid, scoreCalculator)
 	if err != nil {
 		return nil, err
@@ -48,8 +137,15 @@ func New(mid module.MID, client *http.Client, scoreCalculator module.CalculateSc
 	if client == nil {
 		return nil, gerror.NewIllegalParameterError("nil http client")
 	}
+	//检查外来代码
+	for _, middleware := range middlewares {
+		if middleware == nil {
+			return nil, gerror.NewIllegalParameterError("nil downloader middleware")
+		}
+	}
 	return &gureDownloader{
 		ModuleInternal: moduleInternal,
 		httpClient:     *client,
+		middlewares:    append([]module.DownloaderMiddleware(nil), middlewares...),
 	}, nil
 }
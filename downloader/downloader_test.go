@@ -0,0 +1,88 @@
+package downloader
+
+import (
+	"Gure/module"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordMiddleware 记录调用顺序，按照路径短路、丢弃或者恢复错误
+type recordMiddleware struct {
+	name  string
+	calls *[]string
+}
+
+func (m recordMiddleware) ProcessRequest(req *module.Request) (*module.Response, error) {
+	*m.calls = append(*m.calls, m.name+".request")
+	req.HTTPRep().Header.Add("X-Middleware", m.name)
+	switch req.HTTPRep().URL.Path + "@" + m.name {
+	case "/synthetic@b":
+		httpResp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{},
+			Body: io.NopCloser(strings.NewReader("synthetic")), Request: req.HTTPRep()}
+		return module.NewResponse(httpResp, req.Depth()), nil
+	case "/drop@b":
+		return nil, module.ErrRequestDropped
+	case "/fail@b":
+		return nil, errors.New("fail")
+	}
+	return nil, nil
+}
+
+func (m recordMiddleware) ProcessResponse(req *module.Request, resp *module.Response) (*module.Response, error) {
+	*m.calls = append(*m.calls, m.name+".response")
+	return resp, nil
+}
+
+func (m recordMiddleware) ProcessError(req *module.Request, err error) (*module.Response, error) {
+	*m.calls = append(*m.calls, m.name+".error")
+	if m.name == "a" {
+		httpResp := &http.Response{StatusCode: http.StatusNoContent, Header: http.Header{},
+			Body: io.NopCloser(strings.NewReader("")), Request: req.HTTPRep()}
+		return module.NewResponse(httpResp, req.Depth()), nil
+	}
+	return nil, err
+}
+
+func TestDownloader_Middleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Join(r.Header.Values("X-Middleware"), ","))
+	}))
+	defer server.Close()
+	var calls []string
+	loader, err := New("D|1|127.0.0.1:8080", &http.Client{}, nil,
+		recordMiddleware{"a", &calls}, recordMiddleware{"b", &calls}, recordMiddleware{"c", &calls})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path  string
+		body  string
+		err   error
+		calls string
+	}{
+		{"/", "a,b,c", nil, "a.request b.request c.request c.response b.response a.response"},
+		{"/synthetic", "synthetic", nil, "a.request b.request a.response"},
+		{"/drop", "", module.ErrRequestDropped, "a.request b.request a.error"},
+		{"/fail", "", nil, "a.request b.request a.error"},
+	}
+	for _, c := range cases {
+		calls = nil
+		httpReq, _ := http.NewRequest(http.MethodGet, server.URL+c.path, nil)
+		resp, err := loader.Download(module.NewRequest(httpReq, 0))
+		if !errors.Is(err, c.err) || strings.Join(calls, " ") != c.calls {
+			t.Errorf("%s: got err %v calls %v", c.path, err, calls)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		body, _ := io.ReadAll(resp.HTTPResp().Body)
+		if string(body) != c.body {
+			t.Errorf("%s: got body %q want %q", c.path, body, c.body)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package downloader
+
+import (
+	"Gure/gerror"
+	"Gure/module"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// HeaderProfile 一组请求头配置，通常对应一种浏览器
+type HeaderProfile struct {
+	//Name 配置的名称，只用于区分配置
+	Name           string
+	UserAgent      string
+	Accept         string
+	AcceptLanguage string
+	//Header 其他需要设置的请求头
+	Header http.Header
+}
+
+// DefaultHeaderProfiles 默认轮换使用的请求头配置
+var DefaultHeaderProfiles = []HeaderProfile{
+	{
+		Name:           "chrome",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+		AcceptLanguage: "en-US,en;q=0.9",
+	},
+	{
+		Name:           "firefox",
+		UserAgent:      "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		AcceptLanguage: "en-US,en;q=0.5",
+	},
+	{
+		Name:           "safari",
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		AcceptLanguage: "en-US,en;q=0.9",
+	},
+}
+
+// HeaderConfig 请求头轮换设置
+type HeaderConfig struct {
+	//Profiles 轮换使用的请求头配置，为空时使用DefaultHeaderProfiles
+	Profiles []HeaderProfile
+	//Strategy 配置的轮换方式，默认为轮询
+	Strategy RotationStrategy
+	//Domains 按照域名覆盖的请求头配置，同时匹配子域名，多个域名匹配时使用最长的域名
+	Domains map[string][]HeaderProfile
+	//NoReferer 为真时不自动将Referer设置为发现请求的页面
+	NoReferer bool
+}
+
+// HeaderRotator 为请求轮换设置请求头的下载器中间件
+//调用方已经设置的请求头不会被覆盖，Referer默认设置为发现请求的页面链接
+type HeaderRotator interface {
+	module.DownloaderMiddleware
+
+	// Apply 为请求设置请求头
+	Apply(req *module.Request)
+}
+
+type gureHeaderRotator struct {
+	lock      sync.Mutex
+	profiles  []HeaderProfile
+	domains   map[string][]HeaderProfile
+	rotator   *rotator
+	noReferer bool
+}
+
+// NewHeaderRotator 创建请求头轮换中间件
+func NewHeaderRotator(config HeaderConfig) (HeaderRotator, error) {
+	strategy, ok := validRotation(config.Strategy)
+	if !ok {
+		return nil, gerror.NewIllegalParameterError("invalid header strategy " + string(config.Strategy))
+	}
+	profiles := config.Profiles
+	if len(profiles) == 0 {
+		profiles = DefaultHeaderProfiles
+	}
+	domains := make(map[string][]HeaderProfile, len(config.Domains))
+	for domain, list := range config.Domains {
+		normalized := strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if normalized == "" {
+			return nil, gerror.NewIllegalParameterError("empty header domain")
+		}
+		if len(list) == 0 {
+			return nil, gerror.NewIllegalParameterError("empty header profiles for domain " + domain)
+		}
+		domains[normalized] = append([]HeaderProfile(nil), list...)
+	}
+	return &gureHeaderRotator{
+		profiles:  append([]HeaderProfile(nil), profiles...),
+		domains:   domains,
+		rotator:   newRotator(strategy),
+		noReferer: config.NoReferer,
+	}, nil
+}
+
+func (h *gureHeaderRotator) ProcessRequest(req *module.Request) (*module.Response, error) {
+	h.Apply(req)
+	return nil, nil
+}
+
+func (h *gureHeaderRotator) ProcessResponse(req *module.Request, resp *module.Response) (*module.Response, error) {
+	return resp, nil
+}
+
+func (h *gureHeaderRotator) ProcessError(req *module.Request, err error) (*module.Response, error) {
+	return nil, err
+}
+
+func (h *gureHeaderRotator) Apply(req *module.Request) {
+	httpReq := req.HTTPRep()
+	if httpReq.Header == nil {
+		httpReq.Header = http.Header{}
+	}
+	host := strings.ToLower(httpReq.URL.Hostname())
+	profile := h.pick(host)
+	setDefault(httpReq.Header, "User-Agent", profile.UserAgent)
+	setDefault(httpReq.Header, "Accept", profile.Accept)
+	setDefault(httpReq.Header, "Accept-Language", profile.AcceptLanguage)
+	for key, values := range profile.Header {
+		if len(values) > 0 {
+			setDefault(httpReq.Header, key, values[0])
+		}
+	}
+	if !h.noReferer {
+		setDefault(httpReq.Header, "Referer", referer(req.Parent(), httpReq.URL))
+	}
+}
+
+// pick 选择主机使用的请求头配置
+func (h *gureHeaderRotator) pick(host string) HeaderProfile {
+	profiles := h.profiles
+	matched := ""
+	for domain, list := range h.domains {
+		if (host == domain || strings.HasSuffix(host, "."+domain)) && len(domain) > len(matched) {
+			matched, profiles = domain, list
+		}
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	i, _ := h.rotator.pick(host, len(profiles), nil)
+	return profiles[i]
+}
+
+// setDefault 请求头不存在时设置
+func setDefault(header http.Header, key, value string) {
+	if value == "" || header.Get(key) != "" {
+		return
+	}
+	header.Set(key, value)
+}
+
+// referer 根据来源页面生成Referer，去掉片段与用户信息，从https页面发现的http请求不发送Referer
+func referer(parent string, target *url.URL) string {
+	if parent == "" {
+		return ""
+	}
+	u, err := url.Parse(parent)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if u.Scheme == "https" && target.Scheme == "http" {
+		return ""
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,203 @@
+package downloader
+
+import (
+	"Gure/gerror"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProxyFailureThreshold 默认的失败率阈值，超过后暂时禁用代理
+	DefaultProxyFailureThreshold = 0.5
+	// DefaultProxyMinRequests 默认的判断失败率之前至少需要的请求数量
+	DefaultProxyMinRequests = 5
+	// DefaultProxyBanDuration 默认的禁用时长
+	DefaultProxyBanDuration = time.Minute
+	// proxyAlpha 失败率滑动平均的权重
+	proxyAlpha = 0.2
+)
+
+// NoProxyAvailableError 所有代理都被禁用
+var NoProxyAvailableError = errors.New("no proxy available")
+
+// proxyFailureStatus 视为代理失败的状态码，通常表示代理需要认证或者代理的出口被目标站点限制
+var proxyFailureStatus = map[int]bool{
+	http.StatusProxyAuthRequired: true,
+	http.StatusForbidden:         true,
+	http.StatusTooManyRequests:   true,
+}
+
+// ProxyPool 代理池，作为http.Client的Transport为每个请求分配代理
+// 记录每个代理的失败率，失败率过高的代理会被暂时禁用
+type ProxyPool interface {
+	http.RoundTripper
+	SummaryReporter
+
+	// Stats 每个代理的统计信息
+	Stats() []ProxyStats
+}
+
+// ProxyConfig 代理池设置
+type ProxyConfig struct {
+	//Proxies 代理地址，例如 http://127.0.0.1:8080
+	Proxies []string
+	//Strategy 代理的分配方式，默认为轮询，被禁用的代理不参与分配
+	Strategy RotationStrategy
+	//Transport 每个代理使用该Transport的副本发送请求，默认为http.DefaultTransport
+	Transport *http.Transport
+	//FailureThreshold 失败率的滑动平均超过该值时禁用代理，范围为(0,1]
+	FailureThreshold float64
+	//MinRequests 代理至少完成该数量的请求后才判断失败率
+	MinRequests uint32
+	//BanDuration 代理被禁用的时长
+	BanDuration time.Duration
+}
+
+// ProxyStats 单个代理的统计信息
+type ProxyStats struct {
+	Proxy string `json:"proxy"`
+	//Requests 发送的请求数量，Failures 失败的请求数量
+	Requests uint64 `json:"requests"`
+	Failures uint64 `json:"failures"`
+	//FailureRate 失败率的滑动平均
+	FailureRate float64 `json:"failureRate"`
+	//Bans 被禁用的次数，BannedUntil 禁用的截止时间，为零表示可用
+	Bans        uint64    `json:"bans"`
+	BannedUntil time.Time `json:"bannedUntil,omitempty"`
+}
+
+// proxy 单个代理的状态
+type proxy struct {
+	url       *url.URL
+	transport *http.Transport
+	stats     ProxyStats
+	//上次禁用之后完成的请求数量
+	sinceBan uint32
+}
+
+type gureProxyPool struct {
+	lock    sync.Mutex
+	config  ProxyConfig
+	proxies []*proxy
+	rotator *rotator
+	nowFunc func() time.Time
+}
+
+// NewProxyPool 创建代理池
+func NewProxyPool(config ProxyConfig) (ProxyPool, error) {
+	if len(config.Proxies) == 0 {
+		return nil, gerror.NewIllegalParameterError("empty proxies")
+	}
+	strategy, ok := validRotation(config.Strategy)
+	if !ok {
+		return nil, gerror.NewIllegalParameterError("invalid proxy strategy " + string(config.Strategy))
+	}
+	config.Strategy = strategy
+	if config.FailureThreshold == 0 {
+		config.FailureThreshold = DefaultProxyFailureThreshold
+	}
+	if config.FailureThreshold < 0 || config.FailureThreshold > 1 {
+		return nil, gerror.NewIllegalParameterError("invalid proxy FailureThreshold")
+	}
+	if config.MinRequests == 0 {
+		config.MinRequests = DefaultProxyMinRequests
+	}
+	if config.BanDuration <= 0 {
+		config.BanDuration = DefaultProxyBanDuration
+	}
+	base := config.Transport
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	p := &gureProxyPool{
+		config:  config,
+		rotator: newRotator(strategy),
+		nowFunc: time.Now,
+	}
+	for _, raw := range config.Proxies {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, gerror.NewIllegalParameterError("invalid proxy " + raw)
+		}
+		transport := base.Clone()
+		transport.Proxy = http.ProxyURL(u)
+		p.proxies = append(p.proxies, &proxy{url: u, transport: transport, stats: ProxyStats{Proxy: u.Redacted()}})
+	}
+	return p, nil
+}
+
+func (p *gureProxyPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	chosen, err := p.pick(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chosen.transport.RoundTrip(req)
+	p.record(chosen, err != nil || proxyFailureStatus[resp.StatusCode])
+	if err != nil {
+		return nil, fmt.Errorf("request through proxy %s fail with %w", chosen.stats.Proxy, err)
+	}
+	return resp, nil
+}
+
+// pick 按照分配方式选择可用的代理
+func (p *gureProxyPool) pick(host string) (*proxy, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := p.nowFunc()
+	i, ok := p.rotator.pick(host, len(p.proxies), func(i int) bool {
+		return p.proxies[i].available(now)
+	})
+	if !ok {
+		return nil, NoProxyAvailableError
+	}
+	return p.proxies[i], nil
+}
+
+// record 记录请求结果，失败率过高时禁用代理
+func (p *gureProxyPool) record(chosen *proxy, failed bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	chosen.stats.Requests++
+	chosen.sinceBan++
+	if failed {
+		chosen.stats.Failures++
+		chosen.stats.FailureRate += proxyAlpha * (1 - chosen.stats.FailureRate)
+	} else {
+		chosen.stats.FailureRate -= proxyAlpha * chosen.stats.FailureRate
+	}
+	if chosen.sinceBan >= p.config.MinRequests && chosen.stats.FailureRate >= p.config.FailureThreshold {
+		chosen.stats.Bans++
+		chosen.stats.BannedUntil = p.nowFunc().Add(p.config.BanDuration)
+		//禁用结束后重新开始计算失败率
+		chosen.stats.FailureRate = 0
+		chosen.sinceBan = 0
+	}
+}
+
+// available 判断代理是否可用，调用方需要持有锁
+func (x *proxy) available(now time.Time) bool {
+	return !now.Before(x.stats.BannedUntil)
+}
+
+func (p *gureProxyPool) Stats() []ProxyStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := p.nowFunc()
+	stats := make([]ProxyStats, 0, len(p.proxies))
+	for _, x := range p.proxies {
+		s := x.stats
+		if x.available(now) {
+			s.BannedUntil = time.Time{}
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+func (p *gureProxyPool) SummaryExtra() (string, interface{}) {
+	return "proxies", p.Stats()
+}
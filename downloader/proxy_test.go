@@ -0,0 +1,110 @@
+package downloader
+
+import (
+	"Gure/module"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// connectProxy 只支持CONNECT的本地代理，fail为真时拒绝所有隧道
+func connectProxy(t *testing.T, fail bool, tunnels *int64) *httptest.Server {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || fail {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		atomic.AddInt64(tunnels, 1)
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func TestProxyPool(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	var goodTunnels, badTunnels int64
+	good := connectProxy(t, false, &goodTunnels)
+	bad := connectProxy(t, true, &badTunnels)
+
+	base := target.Client().Transport.(*http.Transport).Clone()
+	//每个请求建立新的隧道，便于统计代理的使用次数
+	base.DisableKeepAlives = true
+	pool, err := NewProxyPool(ProxyConfig{
+		Proxies:     []string{good.URL, bad.URL},
+		Transport:   base,
+		MinRequests: 2,
+		BanDuration: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader, err := New("D|1|127.0.0.1:8080", &http.Client{Transport: pool}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//轮询使用两个代理，失败率的滑动平均在连续失败4次后超过阈值，失败的代理被禁用
+	var failures int
+	for i := 0; i < 10; i++ {
+		httpReq, _ := http.NewRequest(http.MethodGet, target.URL, nil)
+		resp, err := loader.Download(module.NewRequest(httpReq, 0))
+		if err != nil {
+			failures++
+			continue
+		}
+		resp.HTTPResp().Body.Close()
+	}
+	if failures != 4 || atomic.LoadInt64(&goodTunnels) != 6 {
+		t.Errorf("got %d failures, %d tunnels through good proxy", failures, goodTunnels)
+	}
+	stats := loader.Summary().Extra.(map[string]interface{})["proxies"].([]ProxyStats)
+	if stats[0].Requests != 6 || stats[0].Failures != 0 || !stats[0].BannedUntil.IsZero() {
+		t.Errorf("unexpected good proxy stats %+v", stats[0])
+	}
+	if stats[1].Requests != 4 || stats[1].Failures != 4 || stats[1].Bans != 1 || stats[1].BannedUntil.IsZero() {
+		t.Errorf("unexpected bad proxy stats %+v", stats[1])
+	}
+
+	//禁用结束后代理重新可用，同一主机固定使用同一个代理
+	sticky, _ := NewProxyPool(ProxyConfig{Proxies: []string{good.URL, bad.URL}, Strategy: RotateStickyHost, Transport: base})
+	gp := sticky.(*gureProxyPool)
+	first, _ := gp.pick("a.com")
+	for i := 0; i < 3; i++ {
+		if chosen, _ := gp.pick("a.com"); chosen != first {
+			t.Fatalf("sticky host should keep proxy %s, got %s", first.stats.Proxy, chosen.stats.Proxy)
+		}
+	}
+	for i := 0; i < DefaultProxyMinRequests; i++ {
+		gp.record(first, true)
+	}
+	if chosen, _ := gp.pick("a.com"); chosen == first {
+		t.Errorf("banned proxy should be replaced")
+	}
+	gp.nowFunc = func() time.Time { return time.Now().Add(2 * DefaultProxyBanDuration) }
+	if stats := sticky.Stats(); !stats[0].BannedUntil.IsZero() || !stats[1].BannedUntil.IsZero() {
+		t.Errorf("ban should expire, got %+v", stats)
+	}
+}
@@ -0,0 +1,77 @@
+package downloader
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RotationStrategy 在多个候选之间轮换的方式，用于代理与请求头配置
+type RotationStrategy string
+
+const (
+	// RotateRoundRobin 依次使用每个可用的候选
+	RotateRoundRobin RotationStrategy = "round-robin"
+	// RotateStickyHost 同一主机的请求固定使用同一个候选，候选不可用后重新分配
+	RotateStickyHost RotationStrategy = "sticky-host"
+	// RotateRandom 随机选择可用的候选
+	RotateRandom RotationStrategy = "random"
+)
+
+// validRotation 检查轮换方式，为空时使用轮询
+func validRotation(strategy RotationStrategy) (RotationStrategy, bool) {
+	switch strategy {
+	case "":
+		return RotateRoundRobin, true
+	case RotateRoundRobin, RotateStickyHost, RotateRandom:
+		return strategy, true
+	}
+	return strategy, false
+}
+
+// rotator 按照轮换方式选择候选的下标，调用方需要负责加锁
+type rotator struct {
+	strategy RotationStrategy
+	next     int
+	sticky   map[string]int
+	random   *rand.Rand
+}
+
+func newRotator(strategy RotationStrategy) *rotator {
+	return &rotator{
+		strategy: strategy,
+		sticky:   map[string]int{},
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// pick 在n个候选中选择一个可用的，host用于固定分配，usable为空时所有候选都可用
+func (r *rotator) pick(host string, n int, usable func(i int) bool) (int, bool) {
+	if usable == nil {
+		usable = func(int) bool { return true }
+	}
+	if r.strategy == RotateStickyHost {
+		if i, ok := r.sticky[host]; ok && i < n && usable(i) {
+			return i, true
+		}
+	}
+	available := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		if usable(i) {
+			available = append(available, i)
+		}
+	}
+	if len(available) == 0 {
+		return 0, false
+	}
+	var chosen int
+	if r.strategy == RotateRandom {
+		chosen = available[r.random.Intn(len(available))]
+	} else {
+		chosen = available[r.next%len(available)]
+		r.next++
+	}
+	if r.strategy == RotateStickyHost {
+		r.sticky[host] = chosen
+	}
+	return chosen, true
+}
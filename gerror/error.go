@@ -18,9 +18,11 @@ type SpiderError struct {
 
 // NewSpiderError 构造方法
 func NewSpiderError(errType module.ErrorType, errMsg string) SpiderError {
-	return SpiderError{errType: errType,
+	s := SpiderError{errType: errType,
 		errMsg: strings.TrimSpace(errMsg),
 	}
+	s.cplErrMsg = s.getCplErrMsg()
+	return s
 }
 
 // Type 返回错误类型
@@ -28,16 +30,21 @@ func (s SpiderError) Type() module.ErrorType {
 	return s.errType
 }
 
+// Msg 返回不包含错误类型的错误信息
+func (s SpiderError) Msg() string {
+	return s.errMsg
+}
+
 //Error 返回格式化后的错误信息
 func (s SpiderError) Error() string {
 	if s.cplErrMsg == "" {
-		s.getCplErrMsg()
+		return s.getCplErrMsg()
 	}
 	return s.cplErrMsg
 }
 
 //getCplErrMsg 应当采用builder形式避免字符串拼接带来的性能影响
-func (s SpiderError) getCplErrMsg() {
+func (s SpiderError) getCplErrMsg() string {
 	builder := strings.Builder{}
 	builder.WriteString("Type:")
 	if s.errType == "" {
@@ -49,5 +56,5 @@ func (s SpiderError) getCplErrMsg() {
 	builder.WriteString(" Msg:")
 	builder.WriteString(s.errMsg)
 
-	s.cplErrMsg = builder.String()
+	return builder.String()
 }
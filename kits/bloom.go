@@ -0,0 +1,208 @@
+package kits
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"math"
+	"sync"
+)
+
+const (
+	// bloomGrowth 每个新过滤器的容量倍数
+	bloomGrowth = 2
+	// bloomTightening 每个新过滤器的误判率系数，保证总误判率收敛
+	bloomTightening = 0.8
+)
+
+// bloomFilter 固定容量的布隆过滤器
+type bloomFilter struct {
+	//位数组
+	bits []uint64
+	//位数组长度
+	m uint64
+	//哈希函数个数
+	k uint64
+	//已添加数量
+	n uint64
+	//容量，超过后误判率将高于设定值
+	capacity uint64
+}
+
+func newBloomFilter(capacity uint64, fpRate float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Ceil(float64(m) / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		capacity: capacity,
+	}
+}
+
+// locations 使用双重哈希计算k个位置
+func (b *bloomFilter) locations(h1, h2 uint64, fn func(loc uint64) bool) bool {
+	for i := uint64(0); i < b.k; i++ {
+		if !fn((h1 + i*h2) % b.m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloomFilter) contains(h1, h2 uint64) bool {
+	return b.locations(h1, h2, func(loc uint64) bool {
+		return b.bits[loc/64]&(1<<(loc%64)) != 0
+	})
+}
+
+func (b *bloomFilter) add(h1, h2 uint64) {
+	b.locations(h1, h2, func(loc uint64) bool {
+		b.bits[loc/64] |= 1 << (loc % 64)
+		return true
+	})
+	b.n++
+}
+
+// bloomVisitedSet 可扩展布隆过滤器，容量用尽时追加容量更大、误判率更低的过滤器
+// 内存占用远小于字典，但存在误判，被误判的链接不会被爬取
+type bloomVisitedSet struct {
+	filters []*bloomFilter
+	//第一个过滤器的容量
+	capacity uint64
+	//第一个过滤器的误判率
+	fpRate float64
+	lock   sync.RWMutex
+}
+
+// hashKey 计算双重哈希所需的两个哈希值
+func hashKey(key string) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(key))
+	sum := h.Sum(nil)
+	h1 := binary.LittleEndian.Uint64(sum[:8])
+	h2 := binary.LittleEndian.Uint64(sum[8:]) | 1 //保证为奇数
+	return h1, h2
+}
+
+func (b *bloomVisitedSet) Add(key string) (bool, error) {
+	h1, h2 := hashKey(key)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, f := range b.filters {
+		if f.contains(h1, h2) {
+			return false, nil
+		}
+	}
+	last := b.filters[len(b.filters)-1]
+	if last.n >= last.capacity {
+		fpRate := b.fpRate * math.Pow(bloomTightening, float64(len(b.filters)))
+		last = newBloomFilter(last.capacity*bloomGrowth, fpRate)
+		b.filters = append(b.filters, last)
+	}
+	last.add(h1, h2)
+	return true, nil
+}
+
+func (b *bloomVisitedSet) Contains(key string) (bool, error) {
+	h1, h2 := hashKey(key)
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, f := range b.filters {
+		if f.contains(h1, h2) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (b *bloomVisitedSet) Len() uint64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	var n uint64
+	for _, f := range b.filters {
+		n += f.n
+	}
+	return n
+}
+
+// bloomSnapshot 布隆过滤器的序列化形式
+type bloomSnapshot struct {
+	Capacity uint64                `json:"capacity"`
+	FPRate   float64               `json:"fpRate"`
+	Filters  []bloomFilterSnapshot `json:"filters"`
+}
+
+type bloomFilterSnapshot struct {
+	M        uint64 `json:"m"`
+	K        uint64 `json:"k"`
+	N        uint64 `json:"n"`
+	Capacity uint64 `json:"capacity"`
+	Bits     []byte `json:"bits"`
+}
+
+func (b *bloomVisitedSet) Snapshot(w io.Writer) error {
+	b.lock.RLock()
+	snapshot := bloomSnapshot{Capacity: b.capacity, FPRate: b.fpRate}
+	for _, f := range b.filters {
+		bits := make([]byte, len(f.bits)*8)
+		for i, word := range f.bits {
+			binary.LittleEndian.PutUint64(bits[i*8:], word)
+		}
+		snapshot.Filters = append(snapshot.Filters, bloomFilterSnapshot{
+			M: f.m, K: f.k, N: f.n, Capacity: f.capacity, Bits: bits,
+		})
+	}
+	b.lock.RUnlock()
+	return json.NewEncoder(w).Encode(&snapshot)
+}
+
+func (b *bloomVisitedSet) Restore(r io.Reader) error {
+	var snapshot bloomSnapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return err
+	}
+	if len(snapshot.Filters) == 0 {
+		return nil
+	}
+	var filters []*bloomFilter
+	for _, s := range snapshot.Filters {
+		if s.M == 0 || s.K == 0 || uint64(len(s.Bits)) != (s.M+63)/64*8 {
+			return ParameterIllegalError
+		}
+		f := &bloomFilter{bits: make([]uint64, (s.M+63)/64), m: s.M, k: s.K, n: s.N, capacity: s.Capacity}
+		for i := range f.bits {
+			f.bits[i] = binary.LittleEndian.Uint64(s.Bits[i*8:])
+		}
+		filters = append(filters, f)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.filters = filters
+	b.capacity = snapshot.Capacity
+	b.fpRate = snapshot.FPRate
+	return nil
+}
+
+func (b *bloomVisitedSet) Close() error {
+	return nil
+}
+
+// NewBloomVisitedSet 创建可扩展布隆过滤器，capacity为第一个过滤器的容量，fpRate为误判率
+func NewBloomVisitedSet(capacity uint32, fpRate float64) (VisitedSet, error) {
+	if capacity == 0 || fpRate <= 0 || fpRate >= 1 {
+		return nil, ParameterIllegalError
+	}
+	return &bloomVisitedSet{
+		filters:  []*bloomFilter{newBloomFilter(uint64(capacity), fpRate*(1-bloomTightening))},
+		capacity: uint64(capacity),
+		fpRate:   fpRate * (1 - bloomTightening),
+	}, nil
+}
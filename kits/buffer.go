@@ -10,7 +10,7 @@ var ParameterIllegalError = errors.New("parameterIllegal error")
 var BufferClosedError = errors.New("buffer closed error")
 
 //Buffer 缓冲器,缓冲池的底层数据类型，扩展通道数据结构
-type Buffer interface {
+type Buffer[T any] interface {
 
 	// Cap 返回缓冲池中缓冲器的统一容量
 	Cap() uint32
@@ -20,11 +20,10 @@ type Buffer interface {
 
 	// Put 向缓冲池中发送数据，如果池子已经关闭则会报错
 	//方法阻塞运行
-	Put(data interface{}) (bool, error)
+	Put(data T) (bool, error)
 
-	// Get 尝试获取数据，关闭会报错
-	//方法阻塞运行
-	Get() (data interface{}, err error)
+	// Get 尝试获取数据，ok为false表示没有数据，关闭会报错
+	Get() (data T, ok bool, err error)
 
 	// Close 关闭缓冲池
 	//如果关闭成功返回true，关闭失败即之前已经关闭过了返回false
@@ -34,36 +33,36 @@ type Buffer interface {
 	Closed() bool
 }
 
-type gureBuffer struct {
-	ch          chan interface{} //数据存放通道
-	closed      int32            //缓冲器的关闭状态
-	closingLock sync.RWMutex     //读写锁，避免竞态
+type gureBuffer[T any] struct {
+	ch          chan T       //数据存放通道
+	closed      int32        //缓冲器的关闭状态
+	closingLock sync.RWMutex //读写锁，避免竞态
 }
 
-func NewGureBuffer(size uint32) (*gureBuffer, error) {
+func NewGureBuffer[T any](size uint32) (*gureBuffer[T], error) {
 	if size == 0 {
 		return nil, ParameterIllegalError
 	}
-	return &gureBuffer{
-		ch: make(chan interface{}, size),
+	return &gureBuffer[T]{
+		ch: make(chan T, size),
 	}, nil
 }
 
-func (g *gureBuffer) Cap() uint32 {
+func (g *gureBuffer[T]) Cap() uint32 {
 	return uint32(cap(g.ch))
 }
 
-func (g *gureBuffer) Len() uint32 {
+func (g *gureBuffer[T]) Len() uint32 {
 	return uint32(len(g.ch))
 }
 
 // Put 非阻塞方法，如果无法放入就返回false，向关闭的通道发送数据会出错
-func (g *gureBuffer) Put(data interface{}) (bool, error) {
+func (g *gureBuffer[T]) Put(data T) (bool, error) {
 	//先尝试获取锁
 	g.closingLock.RLock() //尝试获取读锁
 	defer g.closingLock.RUnlock()
 	//写入获取都是获取读锁，关闭操作必须要获取写锁，因为是互斥的，关闭操作必须要发生在读取写入完成之后
-	if g.Close() {
+	if g.Closed() {
 		return false, BufferClosedError
 	}
 	select {
@@ -75,19 +74,19 @@ func (g *gureBuffer) Put(data interface{}) (bool, error) {
 }
 
 // Get 非阻塞方法，如果向关闭的通道接收数据将会返回错误
-func (g *gureBuffer) Get() (interface{}, error) {
+func (g *gureBuffer[T]) Get() (data T, ok bool, err error) {
 	select {
-	case data, ok := <-g.ch:
+	case data, ok = <-g.ch:
 		if !ok {
-			return nil, BufferClosedError
+			return data, false, BufferClosedError
 		}
-		return data, nil
+		return data, true, nil
 	default:
-		return nil, nil
+		return data, false, nil
 	}
 }
 
-func (g *gureBuffer) Close() bool {
+func (g *gureBuffer[T]) Close() bool {
 	//原子操作，如果为 0 就更换为 1，使用原子操作避免重复关闭
 	if atomic.CompareAndSwapInt32(&g.closed, 0, 1) {
 		//需要获取写锁，与读锁互斥
@@ -100,7 +99,7 @@ func (g *gureBuffer) Close() bool {
 }
 
 // Closed 检查是否已经关闭
-func (g *gureBuffer) Closed() bool {
+func (g *gureBuffer[T]) Closed() bool {
 	if atomic.LoadInt32(&g.closed) == 0 {
 		return false
 	}
@@ -0,0 +1,210 @@
+package kits
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultStripParams 默认去除的跟踪参数，以 * 结尾表示前缀匹配
+var DefaultStripParams = []string{"utm_*", "gclid", "fbclid"}
+
+// CanonicalRules 链接规范化规则，默认开启全部规范化
+// 协议与主机名总是转换为小写
+type CanonicalRules struct {
+	//KeepDefaultPort 保留默认端口，http的80与https的443
+	KeepDefaultPort bool `json:"keepDefaultPort,omitempty"`
+
+	//KeepFragment 保留 # 之后的片段
+	KeepFragment bool `json:"keepFragment,omitempty"`
+
+	//KeepQueryOrder 保留查询参数的原始顺序
+	KeepQueryOrder bool `json:"keepQueryOrder,omitempty"`
+
+	//KeepDotSegments 保留路径中的 . 与 .. 片段
+	KeepDotSegments bool `json:"keepDotSegments,omitempty"`
+
+	//KeepEscapes 保留原始的百分号编码
+	KeepEscapes bool `json:"keepEscapes,omitempty"`
+
+	//StripParams 需要去除的查询参数，以 * 结尾表示前缀匹配，为nil时使用DefaultStripParams
+	StripParams []string `json:"stripParams,omitempty"`
+}
+
+// Canonicalize 返回规范化后的链接副本，不修改原链接
+func (r *CanonicalRules) Canonicalize(u *url.URL) *url.URL {
+	c := *u
+	c.User = nil
+	c.Scheme = strings.ToLower(c.Scheme)
+	c.Host = r.canonicalHost(c.Scheme, c.Host)
+	if !r.KeepFragment {
+		c.Fragment = ""
+		c.RawFragment = ""
+	}
+
+	path := u.EscapedPath()
+	if !r.KeepEscapes {
+		path = normalizeEscapes(path)
+	}
+	if !r.KeepDotSegments {
+		path = removeDotSegments(path)
+	}
+	if path == "" && c.Host != "" {
+		path = "/"
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		c.Path = unescaped
+		c.RawPath = path
+	}
+
+	c.RawQuery = r.canonicalQuery(u.RawQuery)
+	c.ForceQuery = false
+	return &c
+}
+
+// canonicalHost 主机名转换为小写并去除默认端口
+func (r *CanonicalRules) canonicalHost(scheme, host string) string {
+	host = strings.ToLower(host)
+	if r.KeepDefaultPort {
+		return host
+	}
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		if strings.Contains(hostname, ":") {
+			return "[" + hostname + "]"
+		}
+		return hostname
+	}
+	return host
+}
+
+// canonicalQuery 去除跟踪参数，规范编码并按照参数排序
+func (r *CanonicalRules) canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	strip := r.StripParams
+	if strip == nil {
+		strip = DefaultStripParams
+	}
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		key := param
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			key = param[:i]
+		}
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if matchParam(strip, key) {
+			continue
+		}
+		if !r.KeepEscapes {
+			param = normalizeEscapes(param)
+		}
+		params = append(params, param)
+	}
+	if !r.KeepQueryOrder {
+		sort.Strings(params)
+	}
+	return strings.Join(params, "&")
+}
+
+// matchParam 判断参数名是否匹配需要去除的参数
+func matchParam(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(key, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if key == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEscapes 解码非保留字符的百分号编码，其余编码统一为大写
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	const hex = "0123456789ABCDEF"
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			builder.WriteByte(s[i])
+			continue
+		}
+		b := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(b) {
+			builder.WriteByte(b)
+		} else {
+			builder.WriteByte('%')
+			builder.WriteByte(hex[b>>4])
+			builder.WriteByte(hex[b&15])
+		}
+		i += 2
+	}
+	return builder.String()
+}
+
+// removeDotSegments 按照RFC 3986去除路径中的 . 与 .. 片段
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	var out []string
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+	result := strings.Join(out, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// isUnreserved 判断是否为RFC 3986中的非保留字符
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,33 @@
+package kits
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalRules_Canonicalize(t *testing.T) {
+	var cases = []struct {
+		rules CanonicalRules
+		raw   string
+		want  string
+	}{
+		{CanonicalRules{}, "http://A.com/x?b=2&a=1#frag", "http://a.com/x?a=1&b=2"},
+		{CanonicalRules{}, "HTTPS://Example.COM:443/a/./b/../c?utm_source=x&id=%7e%2f", "https://example.com/a/c?id=~%2F"},
+		{CanonicalRules{}, "http://example.com:8080", "http://example.com:8080/"},
+		{CanonicalRules{}, "http://example.com/%7Euser/%e4%b8%ad", "http://example.com/~user/%E4%B8%AD"},
+		{CanonicalRules{KeepFragment: true, KeepQueryOrder: true, StripParams: []string{}}, "http://a.com/x?b=2&utm_id=1#f", "http://a.com/x?b=2&utm_id=1#f"},
+		{CanonicalRules{KeepDefaultPort: true}, "http://a.com:80/", "http://a.com:80/"},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.rules.Canonicalize(u).String(); got != c.want {
+			t.Errorf("Canonicalize(%s) = %s, want %s", c.raw, got, c.want)
+		}
+		if u.String() == c.want && c.raw != c.want {
+			t.Errorf("Canonicalize(%s) modified the original url", c.raw)
+		}
+	}
+}
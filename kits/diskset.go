@@ -0,0 +1,358 @@
+package kits
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// diskSetFileName 磁盘集合的数据文件名
+	diskSetFileName = "visited.set"
+	// diskSetSnapshotSuffix 快照文件的后缀，快照文件名为 visited.<序号>.snap
+	diskSetSnapshotSuffix = ".snap"
+	// diskSetMagic 数据文件头部的标识
+	diskSetMagic = "GUREVSET"
+	// diskSetHeaderSize 文件头部大小，依次为标识、槽位数量、键数量
+	diskSetHeaderSize = 24
+	// diskSetSlotSize 每个槽位保存128位的键指纹
+	diskSetSlotSize = 16
+	// diskSetInitSlots 初始槽位数量，必须为2的幂
+	diskSetInitSlots = 1 << 16
+)
+
+var diskSetCorruptedError = errors.New("visited set file corrupted")
+
+// diskVisitedSet 基于磁盘文件的已访问集合
+// 文件是一张开放寻址的哈希表，保存键的128位指纹，查找通过随机读完成，内存占用与链接数量无关
+// 负载超过一半时创建两倍大小的新文件并重新插入，数据目录在重启后可以继续使用
+// 数据文件随着添加实时修改，Snapshot时复制一份带序号的快照，Restore时使用快照替换数据文件
+// 因此断点之后添加的键不会在恢复断点时残留，只保留最近两份快照
+type diskVisitedSet struct {
+	lock sync.Mutex
+	//数据目录
+	dir string
+	//下一份快照的序号
+	snapshotSeq uint64
+	//数据文件
+	file *os.File
+	//槽位数量
+	slots uint64
+	//键数量
+	count uint64
+}
+
+// fingerprint 计算键的指纹，全零指纹表示空槽位，需要避开
+func fingerprint(key string) [diskSetSlotSize]byte {
+	var fp [diskSetSlotSize]byte
+	h := fnv.New128a()
+	h.Write([]byte(key))
+	copy(fp[:], h.Sum(nil))
+	fp[diskSetSlotSize-1] |= 1
+	return fp
+}
+
+// slotOf 计算指纹的初始槽位，对指纹再做一次混合使低位分布均匀
+func slotOf(fp [diskSetSlotSize]byte, slots uint64) uint64 {
+	x := binary.LittleEndian.Uint64(fp[:8])
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x & (slots - 1)
+}
+
+// probe 查找指纹所在的槽位，返回指纹是否存在以及可以写入的空槽位
+func probe(file *os.File, slots uint64, fp [diskSetSlotSize]byte) (found bool, slot uint64, err error) {
+	var buf [diskSetSlotSize]byte
+	var empty [diskSetSlotSize]byte
+	slot = slotOf(fp, slots)
+	for i := uint64(0); i < slots; i++ {
+		if _, err = file.ReadAt(buf[:], diskSetHeaderSize+int64(slot)*diskSetSlotSize); err != nil {
+			return false, 0, err
+		}
+		if buf == empty {
+			return false, slot, nil
+		}
+		if buf == fp {
+			return true, slot, nil
+		}
+		slot = (slot + 1) & (slots - 1)
+	}
+	return false, 0, diskSetCorruptedError
+}
+
+func (d *diskVisitedSet) Add(key string) (bool, error) {
+	fp := fingerprint(key)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.file == nil {
+		return false, BufferClosedError
+	}
+	found, slot, err := probe(d.file, d.slots, fp)
+	if err != nil || found {
+		return false, err
+	}
+	if (d.count+1)*2 > d.slots {
+		if err = d.grow(); err != nil {
+			return false, err
+		}
+		if _, slot, err = probe(d.file, d.slots, fp); err != nil {
+			return false, err
+		}
+	}
+	if _, err = d.file.WriteAt(fp[:], diskSetHeaderSize+int64(slot)*diskSetSlotSize); err != nil {
+		return false, err
+	}
+	d.count++
+	return true, d.writeHeader(d.file, d.slots, d.count)
+}
+
+func (d *diskVisitedSet) Contains(key string) (bool, error) {
+	fp := fingerprint(key)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.file == nil {
+		return false, BufferClosedError
+	}
+	found, _, err := probe(d.file, d.slots, fp)
+	return found, err
+}
+
+func (d *diskVisitedSet) Len() uint64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.count
+}
+
+// diskSnapshot 写入断点中的快照信息
+type diskSnapshot struct {
+	//Snapshot 数据目录中的快照文件名
+	Snapshot string `json:"snapshot"`
+	Count    uint64 `json:"count"`
+}
+
+// Snapshot 将数据文件复制为新的快照，写入快照的文件名
+func (d *diskVisitedSet) Snapshot(w io.Writer) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.file == nil {
+		return BufferClosedError
+	}
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("visited.%d%s", d.snapshotSeq, diskSetSnapshotSuffix)
+	if err := copyFile(d.file, filepath.Join(d.dir, name)); err != nil {
+		return fmt.Errorf("copy visited set snapshot fail with %v", err)
+	}
+	//上一份快照可能仍然被尚未写完的断点之前的断点引用，更早的快照可以删除
+	if d.snapshotSeq >= 2 {
+		os.Remove(filepath.Join(d.dir, fmt.Sprintf("visited.%d%s", d.snapshotSeq-2, diskSetSnapshotSuffix)))
+	}
+	d.snapshotSeq++
+	return json.NewEncoder(w).Encode(diskSnapshot{Snapshot: name, Count: d.count})
+}
+
+// Restore 使用快照替换数据文件
+func (d *diskVisitedSet) Restore(r io.Reader) error {
+	var snapshot *diskSnapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return err
+	}
+	if snapshot == nil || snapshot.Snapshot == "" || filepath.Base(snapshot.Snapshot) != snapshot.Snapshot {
+		return diskSetCorruptedError
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.file == nil {
+		return BufferClosedError
+	}
+	src, err := os.Open(filepath.Join(d.dir, snapshot.Snapshot))
+	if err != nil {
+		return fmt.Errorf("open visited set snapshot fail with %v", err)
+	}
+	defer src.Close()
+	path := filepath.Join(d.dir, diskSetFileName)
+	if err = copyFile(src, path); err != nil {
+		return fmt.Errorf("restore visited set snapshot fail with %v", err)
+	}
+	file, slots, count, err := openDiskSet(path)
+	if err != nil {
+		return err
+	}
+	d.file.Close()
+	d.file, d.slots, d.count = file, slots, count
+	return nil
+}
+
+// copyFile 将src的内容复制到path，先写入临时文件再重命名
+func copyFile(src *os.File, path string) error {
+	tmp := path + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, io.NewSectionReader(src, 0, 1<<62))
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (d *diskVisitedSet) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
+
+func (d *diskVisitedSet) writeHeader(file *os.File, slots, count uint64) error {
+	var header [diskSetHeaderSize]byte
+	copy(header[:8], diskSetMagic)
+	binary.LittleEndian.PutUint64(header[8:16], slots)
+	binary.LittleEndian.PutUint64(header[16:24], count)
+	_, err := file.WriteAt(header[:], 0)
+	return err
+}
+
+// grow 创建两倍大小的数据文件，顺序读取旧文件中的指纹并重新插入
+func (d *diskVisitedSet) grow() error {
+	path := filepath.Join(d.dir, diskSetFileName)
+	tmp := path + ".tmp"
+	newFile, newSlots, err := d.create(tmp, d.slots*2)
+	if err != nil {
+		return err
+	}
+	var empty [diskSetSlotSize]byte
+	buf := make([]byte, diskSetSlotSize*4096)
+	for offset := uint64(0); offset < d.slots; offset += 4096 {
+		n, err := d.file.ReadAt(buf, diskSetHeaderSize+int64(offset)*diskSetSlotSize)
+		if err != nil && err != io.EOF {
+			newFile.Close()
+			return err
+		}
+		for i := 0; i+diskSetSlotSize <= n; i += diskSetSlotSize {
+			var fp [diskSetSlotSize]byte
+			copy(fp[:], buf[i:i+diskSetSlotSize])
+			if fp == empty {
+				continue
+			}
+			_, slot, err := probe(newFile, newSlots, fp)
+			if err == nil {
+				_, err = newFile.WriteAt(fp[:], diskSetHeaderSize+int64(slot)*diskSetSlotSize)
+			}
+			if err != nil {
+				newFile.Close()
+				return err
+			}
+		}
+	}
+	if err = d.writeHeader(newFile, newSlots, d.count); err != nil {
+		newFile.Close()
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		newFile.Close()
+		return err
+	}
+	d.file.Close()
+	d.file = newFile
+	d.slots = newSlots
+	return nil
+}
+
+// create 创建指定槽位数量的空数据文件
+func (d *diskVisitedSet) create(path string, slots uint64) (*os.File, uint64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = file.Truncate(diskSetHeaderSize + int64(slots)*diskSetSlotSize); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if err = d.writeHeader(file, slots, 0); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, slots, nil
+}
+
+// NewDiskVisitedSet 在dir中创建或打开基于磁盘的已访问集合
+func NewDiskVisitedSet(dir string) (VisitedSet, error) {
+	if dir == "" {
+		return nil, ParameterIllegalError
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	d := &diskVisitedSet{dir: dir}
+	//新的快照序号接在已有快照之后
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "visited.") || !strings.HasSuffix(name, diskSetSnapshotSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "visited."), diskSetSnapshotSuffix), 10, 64)
+		if err == nil && seq >= d.snapshotSeq {
+			d.snapshotSeq = seq + 1
+		}
+	}
+	path := filepath.Join(dir, diskSetFileName)
+	d.file, d.slots, d.count, err = openDiskSet(path)
+	if os.IsNotExist(err) {
+		if d.file, d.slots, err = d.create(path, diskSetInitSlots); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// openDiskSet 打开已有的数据文件并读取头部
+func openDiskSet(path string) (file *os.File, slots, count uint64, err error) {
+	file, err = os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	var header [diskSetHeaderSize]byte
+	if _, err = file.ReadAt(header[:], 0); err != nil {
+		file.Close()
+		return nil, 0, 0, fmt.Errorf("read visited set header fail with %v", err)
+	}
+	slots = binary.LittleEndian.Uint64(header[8:16])
+	if !bytes.Equal(header[:8], []byte(diskSetMagic)) || slots == 0 || slots&(slots-1) != 0 {
+		file.Close()
+		return nil, 0, 0, diskSetCorruptedError
+	}
+	return file, slots, binary.LittleEndian.Uint64(header[16:24]), nil
+}
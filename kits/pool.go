@@ -1,14 +1,30 @@
 package kits
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const EXTRA = 10
 
-// Pool 数据缓冲池，底层由数据缓冲器支撑构造
-type Pool interface {
+// OverflowPolicy 缓冲池已满时的处理策略
+type OverflowPolicy string
+
+const (
+	// PolicyBlock 阻塞直到有空间，向上游施加反压
+	PolicyBlock OverflowPolicy = "block"
+	// PolicyDropOldest 丢弃池中最早的数据后放入
+	PolicyDropOldest OverflowPolicy = "drop-oldest"
+	// PolicyDropNewest 丢弃正在放入的数据
+	PolicyDropNewest OverflowPolicy = "drop-newest"
+	// PolicySpill 将数据编码后写入磁盘，内存中的数据取完后再分批读回内存
+	PolicySpill OverflowPolicy = "spill"
+)
+
+// Pool 数据缓冲池，底层由数据缓冲器支撑构造，缓冲器数量随数据量增减
+type Pool[T any] interface {
 
 	// BufferCap 返回缓冲池中缓冲器的统一容量
 	BufferCap() uint32
@@ -19,16 +35,31 @@ type Pool interface {
 	// BufferNum 缓冲器数量
 	BufferNum() uint32
 
-	// Total 数据总量
-	Total() uint64
+	// Len 数据总量，包括溢出到磁盘的数据
+	Len() uint64
+
+	// Cap 内存中最多容纳的数据量
+	Cap() uint64
+
+	// Put 向缓冲池中发送数据，缓冲池已满时按照溢出策略处理，如果池子已经关闭则会报错
+	//阻塞策略下等待直到有空间、ctx结束或者池子关闭
+	Put(ctx context.Context, data T) error
 
-	// Put 向缓冲池中发送数据，如果池子已经关闭则会报错
-	//方法阻塞运行
-	Put(data interface{}) error
+	// Get 获取数据，没有数据时等待直到有数据、ctx结束或者池子关闭，关闭会报错
+	Get(ctx context.Context) (data T, err error)
 
-	// Get 尝试获取数据，关闭会报错
-	//方法阻塞运行
-	Get() (data interface{}, err error)
+	// TryGet 非阻塞获取数据，没有数据时ok为false，关闭会报错
+	//无法从磁盘还原的溢出数据会被跳过并计入被丢弃的数量，只有关闭时返回BufferClosedError
+	TryGet() (data T, ok bool, err error)
+
+	// Policy 缓冲池已满时的处理策略
+	Policy() OverflowPolicy
+
+	// Dropped 因为缓冲池已满被丢弃的数据数量
+	Dropped() uint64
+
+	// Stats 缓冲池的统计信息
+	Stats() PoolStats
 
 	// Close 关闭缓冲池
 	//如果关闭成功返回true，关闭失败即之前已经关闭过了返回false
@@ -37,195 +68,582 @@ type Pool interface {
 	// Closed 判断缓冲池是否已经关闭
 	Closed() bool
 }
-type gurePool struct {
+
+// PoolStats 缓冲池的统计信息
+type PoolStats struct {
+	//Len 数据总量，包括溢出到磁盘的数据
+	Len uint64 `json:"len"`
+	//Cap 内存中最多容纳的数据量
+	Cap uint64 `json:"cap"`
+	//Puts 放入的数据数量，不包括被丢弃的数据
+	Puts uint64 `json:"puts"`
+	//Gets 取出的数据数量
+	Gets uint64 `json:"gets"`
+	//PutWaits 放入时需要等待的次数
+	PutWaits uint64 `json:"putWaits"`
+	//PutWaitTime 放入时累计的等待时间
+	PutWaitTime time.Duration `json:"putWaitTime"`
+	//GetWaits 取出时需要等待的次数
+	GetWaits uint64 `json:"getWaits"`
+	//GetWaitTime 取出时累计的等待时间
+	GetWaitTime time.Duration `json:"getWaitTime"`
+}
+
+// PoolConfig 缓冲池设置
+type PoolConfig[T any] struct {
+	//BufferCap 缓冲器的统一容量
+	BufferCap uint32
+	//MaxBufferNum 最大的缓冲器数量
+	MaxBufferNum uint32
+	//Policy 缓冲池已满时的处理策略，默认为阻塞
+	Policy OverflowPolicy
+	//SpillDir 溢出文件所在目录，为空时使用系统临时目录，关闭后删除
+	SpillDir string
+	//DataDir 持久化的数据目录，设置后使用溢出策略，溢出的数据直接保存在其中
+	//关闭时内存中的数据也会写入，重新打开同一目录后继续取出
+	//内存中的数据包括从磁盘读回的一批数据只在正常关闭时写入，进程崩溃时会丢失
+	DataDir string
+	//SegmentSize 溢出分段文件的大小，默认为DefaultSegmentSize
+	SegmentSize int64
+	//Codec 溢出到磁盘时数据的编码方式，溢出策略下必须提供
+	Codec Codec[T]
+	//OnDrop 数据被丢弃时调用
+	OnDrop func(data T)
+	//OnLost 溢出的数据无法从磁盘还原时调用，n为丢失的数据数量，丢失的数据计入被丢弃的数量
+	OnLost func(n uint64, err error)
+}
+
+// poolSignal 等待条件的通知，只有存在等待的协程时才会关闭并替换通道
+type poolSignal struct {
+	lock    sync.Mutex
+	ch      chan struct{}
+	waiters int
+}
+
+// wait 登记等待并返回当前的通知通道，等待结束后需要调用leave
+func (s *poolSignal) wait() <-chan struct{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ch == nil {
+		s.ch = make(chan struct{})
+	}
+	s.waiters++
+	return s.ch
+}
+
+func (s *poolSignal) leave() {
+	s.lock.Lock()
+	s.waiters--
+	s.lock.Unlock()
+}
+
+// broadcast 唤醒所有等待的协程
+func (s *poolSignal) broadcast() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.waiters > 0 {
+		close(s.ch)
+		s.ch = make(chan struct{})
+	}
+}
+
+type gurePool[T any] struct {
+	//池中数据总数
+	total uint64
+	//被丢弃的数据数量
+	dropped uint64
+	//放入与取出的数据数量
+	puts uint64
+	gets uint64
+	//需要等待的次数以及累计的等待时间，单位为纳秒
+	putWaits     uint64
+	getWaits     uint64
+	putWaitNanos int64
+	getWaitNanos int64
 	//统一缓冲器大小
 	bufferCap uint32
 	//最大缓冲器数量
 	maxBufferNum uint32
 	//缓冲器实际数量
 	bufferNumber uint32
-	//池中数据总数
-	total uint64
-	//存放数据的通道
-	bufChan chan *gureBuffer
 	//缓冲池状态
 	closed uint32
+	//存放数据的通道
+	bufChan chan *gureBuffer[T]
+	//被取出尚未放回的缓冲器数量，关闭时等待全部放回
+	borrowed int
+	//关闭后放回的缓冲器中剩余的数据，持久化时一起保存
+	leftover []T
+	//保护borrowed与leftover，缓冲器全部放回时唤醒关闭的协程
+	borrowLock sync.Mutex
+	returned   *sync.Cond
 	//读写保护
 	rwLock sync.RWMutex
+	//溢出策略
+	policy OverflowPolicy
+	//溢出到磁盘的数据，仅在溢出策略下不为空
+	spill *spillQueue[T]
+	//保证读回内存与判断是否继续溢出互斥，读回期间放入的数据继续溢出，保证先进先出
+	refillLock sync.Mutex
+	//关闭时是否保存内存中的数据
+	persistent bool
+	//数据被丢弃时的回调
+	onDrop func(data T)
+	//溢出的数据丢失时的回调
+	onLost func(n uint64, err error)
+	//有数据放入时唤醒等待取出的协程，有数据取出时唤醒等待放入的协程
+	notEmpty poolSignal
+	notFull  poolSignal
 }
 
-func (g *gurePool) BufferCap() uint32 {
+func (g *gurePool[T]) BufferCap() uint32 {
 	return g.bufferCap
 }
 
-func (g *gurePool) MaxBufferNum() uint32 {
+func (g *gurePool[T]) MaxBufferNum() uint32 {
 	return g.maxBufferNum
 }
 
 // BufferNum 原子操作，避免竞态
-func (g *gurePool) BufferNum() (num uint32) {
+func (g *gurePool[T]) BufferNum() (num uint32) {
 	return atomic.LoadUint32(&g.bufferNumber)
 }
 
-func (g *gurePool) Total() uint64 {
-	return uint64(atomic.LoadUint64(&g.total))
+func (g *gurePool[T]) Len() uint64 {
+	return atomic.LoadUint64(&g.total)
 }
 
-func (g *gurePool) Put(data interface{}) (err error) {
-	//取出一个buffer填充后重新放入
-	if g.Closed() {
-		return BufferClosedError
+func (g *gurePool[T]) Cap() uint64 {
+	return uint64(g.bufferCap) * uint64(g.maxBufferNum)
+}
+
+func (g *gurePool[T]) Policy() OverflowPolicy {
+	return g.policy
+}
+
+func (g *gurePool[T]) Dropped() uint64 {
+	return atomic.LoadUint64(&g.dropped)
+}
+
+func (g *gurePool[T]) Stats() PoolStats {
+	return PoolStats{
+		Len:         g.Len(),
+		Cap:         g.Cap(),
+		Puts:        atomic.LoadUint64(&g.puts),
+		Gets:        atomic.LoadUint64(&g.gets),
+		PutWaits:    atomic.LoadUint64(&g.putWaits),
+		PutWaitTime: time.Duration(atomic.LoadInt64(&g.putWaitNanos)),
+		GetWaits:    atomic.LoadUint64(&g.getWaits),
+		GetWaitTime: time.Duration(atomic.LoadInt64(&g.getWaitNanos)),
 	}
-	var count uint32              //记录失败次数
-	maxCount := g.BufferNum() * 3 //当前数量的五倍
-	var ok bool
-	for buf := range g.bufChan {
-		ok, err = g.putData(buf, data, &count, maxCount)
-		if ok || err != nil { //数据填入成功或者出现错误，即pool关闭就返回
-			break
+}
+
+func (g *gurePool[T]) Put(ctx context.Context, data T) error {
+	var waitStart time.Time
+	defer func() {
+		if !waitStart.IsZero() {
+			atomic.AddInt64(&g.putWaitNanos, int64(time.Since(waitStart)))
+		}
+	}()
+	for {
+		//已经有数据溢出时继续溢出，保证先进先出
+		if spilled, err := g.spillBehind(data); spilled || err != nil {
+			return err
+		}
+		ok, err := g.tryPut(data)
+		if ok || err != nil {
+			return err
+		}
+		switch g.policy {
+		case PolicySpill:
+			return g.spillData(data)
+		case PolicyDropNewest:
+			g.drop(data)
+			return nil
+		case PolicyDropOldest:
+			oldest, ok, err := g.TryGet()
+			if err != nil {
+				return err
+			}
+			if ok {
+				g.drop(oldest)
+			}
+			continue
+		}
+		//先登记等待再重新尝试，避免错过两次尝试之间取出的数据
+		signal := g.notFull.wait()
+		if ok, err = g.tryPut(data); ok || err != nil {
+			g.notFull.leave()
+			return err
+		}
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+			atomic.AddUint64(&g.putWaits, 1)
+		}
+		select {
+		case <-signal:
+			g.notFull.leave()
+		case <-ctx.Done():
+			g.notFull.leave()
+			return ctx.Err()
 		}
 	}
-	return
 }
 
-func (g *gurePool) Get() (data interface{}, err error) {
-	//判断是否已经关闭
-	if g.Closed() {
-		return
-	}
-	var count uint32
-	maxCount := g.BufferNum() * 8 //当前数量的五倍
-	for buf := range g.bufChan {
-		data, err = g.getData(buf, &count, maxCount)
-		if data != nil || err != nil {
-			break
+func (g *gurePool[T]) Get(ctx context.Context) (data T, err error) {
+	var waitStart time.Time
+	defer func() {
+		if !waitStart.IsZero() {
+			atomic.AddInt64(&g.getWaitNanos, int64(time.Since(waitStart)))
+		}
+	}()
+	for {
+		data, ok, err := g.TryGet()
+		if ok || err != nil {
+			return data, err
+		}
+		//先登记等待再重新尝试，避免错过两次尝试之间放入的数据
+		signal := g.notEmpty.wait()
+		if data, ok, err = g.TryGet(); ok || err != nil {
+			g.notEmpty.leave()
+			return data, err
+		}
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+			atomic.AddUint64(&g.getWaits, 1)
+		}
+		select {
+		case <-signal:
+			g.notEmpty.leave()
+		case <-ctx.Done():
+			g.notEmpty.leave()
+			return data, ctx.Err()
 		}
 	}
-	return
 }
 
-func (g *gurePool) Close() bool {
-	if g.Closed() {
-		return false
+func (g *gurePool[T]) TryGet() (data T, ok bool, err error) {
+	data, ok, err = g.tryGet()
+	if !ok && err == nil && g.spill != nil {
+		//内存中没有数据时再读取溢出的数据
+		data, ok, err = g.refill()
+	}
+	if ok {
+		atomic.AddUint64(&g.gets, 1)
+		g.notFull.broadcast()
 	}
+	return
+}
+
+func (g *gurePool[T]) Close() bool {
 	//尝试获取锁,写锁与读锁互斥
 	g.rwLock.Lock()
-	defer g.rwLock.Unlock()
+	if !atomic.CompareAndSwapUint32(&g.closed, 0, 1) {
+		g.rwLock.Unlock()
+		return false
+	}
 	close(g.bufChan) //关闭所有的buf
+	var head []T
 	for buf := range g.bufChan {
-		buf.Close()
+		//持久化时取出内存中的数据，写入溢出队列的最前面
+		head = append(head, g.release(buf)...)
+	}
+	g.rwLock.Unlock()
+	//等待正在使用的缓冲器放回，其中的数据同样需要保存
+	g.borrowLock.Lock()
+	for g.borrowed > 0 {
+		g.returned.Wait()
 	}
+	head = append(head, g.leftover...)
+	g.leftover = nil
+	g.borrowLock.Unlock()
+	if g.spill != nil {
+		if err := g.spill.Compact(head); err != nil {
+			g.drop(head...)
+		}
+		g.spill.Close()
+	}
+	//唤醒所有等待的协程
+	g.notEmpty.broadcast()
+	g.notFull.broadcast()
 	return true
 }
 
-func (g *gurePool) Closed() bool {
+func (g *gurePool[T]) Closed() bool {
 	return atomic.LoadUint32(&g.closed) == 1
 }
 
-func (g *gurePool) putData(buf *gureBuffer, data interface{}, count *uint32, max uint32) (ok bool, err error) {
-	//原子判断是否关闭
-	if g.Closed() {
-		return false, BufferClosedError
+func (g *gurePool[T]) drop(data ...T) {
+	atomic.AddUint64(&g.dropped, uint64(len(data)))
+	if g.onDrop != nil {
+		for _, d := range data {
+			g.onDrop(d)
+		}
 	}
-	defer func() {
-		g.rwLock.RLock() //获取读锁，避免关闭操作发生
-		//检查是否关闭
-		if g.Closed() { //缓存数量减一，表示没有重新置入。原子操作避免竞态
-			atomic.AddUint32(&g.bufferNumber, ^uint32(0))
-			err = BufferClosedError
-			buf.Close() //及时关闭避免内存泄露
-		} else {
-			//重新加回去，此时是线程安全的，这个步骤可能会产生阻塞，因为此时通道可能已经满了
-			g.bufChan <- buf
-		}
-		g.rwLock.RUnlock() //解锁
-	}()
-	//如果没有关闭,返回false表示没有写入失败，err不为nil表示通道关闭
-	ok, err = buf.Put(data)
-	if ok { //写入成功，直接返回即可,此时添加total，表示数据量+1
-		atomic.AddUint64(&g.total, 1)
-		return
+}
+
+// lose 溢出的数据无法还原，从数据总数中移除并计入被丢弃的数量
+func (g *gurePool[T]) lose(n uint64, err error) {
+	atomic.AddUint64(&g.total, ^(n - 1))
+	atomic.AddUint64(&g.dropped, n)
+	if g.onLost != nil {
+		g.onLost(n, err)
+	}
+}
+
+func (g *gurePool[T]) spillData(data T) error {
+	if err := g.spill.Push(data); err != nil {
+		return err
+	}
+	atomic.AddUint64(&g.total, 1)
+	atomic.AddUint64(&g.puts, 1)
+	g.notEmpty.broadcast()
+	return nil
+}
+
+// spillBehind 已经有数据溢出时将数据写入磁盘，spilled为false时需要放入内存
+func (g *gurePool[T]) spillBehind(data T) (spilled bool, err error) {
+	if g.spill == nil {
+		return false, nil
+	}
+	g.refillLock.Lock()
+	defer g.refillLock.Unlock()
+	if g.spill.Len() == 0 {
+		return false, nil
 	}
-	//出现错误，表示通道关闭,直接返回即可，get还要用到
-	if err != nil {
+	return true, g.spillData(data)
+}
+
+// refill 从磁盘读回一批溢出的数据放入内存，返回其中最早的一条，调用方需要确认内存中已经没有数据
+// 每次最多读回一个缓冲器容量的数据，之后的数据直接从内存取出，磁盘中的数据全部读回后放入的数据重新写入内存
+func (g *gurePool[T]) refill() (data T, ok bool, err error) {
+	g.refillLock.Lock()
+	defer g.refillLock.Unlock()
+	if data, ok, err = g.spill.Pop(); !ok {
 		return
 	}
-	//此时是没有err也没有放入成功，需要进行false操作,count操作是线程安全的
-	*count++
-	//count表示向所有的buffer放置数据
-	//判断是否需要新增buffer,需要调用原子方法避免竞态操作
-	if *count >= max && g.BufferNum() < g.MaxBufferNum() {
-		//说明此时能够创建新的
-		//尝试获取锁,不因该是读写锁，避免新增的时候被填满了
-		g.rwLock.Lock()
-		//避免获取锁的过程中被填满了或者被关闭了
-		if g.BufferNum() < g.MaxBufferNum() {
-			if g.Closed() {
-				g.rwLock.Unlock()
-				return
+	atomic.AddUint64(&g.total, ^uint64(0))
+	//读回期间关闭时需要等待，无法放入内存的数据交给关闭的协程保存
+	g.borrowLock.Lock()
+	g.borrowed++
+	g.borrowLock.Unlock()
+	var rest []T
+	for i := uint32(1); i < g.bufferCap; i++ {
+		next, popped, popErr := g.spill.Pop()
+		if !popped || popErr != nil {
+			break
+		}
+		//放入内存时会重新计入总数
+		atomic.AddUint64(&g.total, ^uint64(0))
+		if put, putErr := g.store(next); !put {
+			//只有关闭时才会失败
+			if putErr != nil && g.persistent {
+				rest = append(rest, next)
+			} else {
+				g.drop(next)
 			}
-			newBuf, _ := NewGureBuffer(g.bufferCap)
-			newBuf.Put(data)
-			g.bufChan <- newBuf
-			atomic.AddUint32(&g.bufferNumber, 1)
-			atomic.AddUint64(&g.total, 1)
-			ok = true
+			break
 		}
-		//如果已经被填满了，解锁返回
-		g.rwLock.Unlock()
-		return
 	}
+	g.giveBack(rest)
 	return
 }
 
-func (g *gurePool) getData(buf *gureBuffer, count *uint32, max uint32) (data interface{}, err error) {
-	//大致类似
-	if g.Closed() {
-		return nil, BufferClosedError
+// takeBuffer 取出一个缓冲器，使用完毕后需要调用returnBuffer放回或者discardBuffer移除
+func (g *gurePool[T]) takeBuffer() (*gureBuffer[T], bool) {
+	g.borrowLock.Lock()
+	g.borrowed++
+	g.borrowLock.Unlock()
+	buf, ok := <-g.bufChan
+	if !ok {
+		g.giveBack(nil)
 	}
-	defer func() {
-		//如果多次获取仍然获取不到，并且当前缓冲区没有数据，缓冲池还有其他缓冲器
-		if *count >= max && buf.Len() == 0 && g.BufferNum() > 1 {
-			//缩小缓冲区
-			buf.Close()
-			atomic.AddUint32(&g.bufferNumber, ^uint32(0))
-			*count = 0 //重新计数
-			return
-		}
-		//否则的话就塞回去，塞回去要获得读写锁，避免中途被关闭了
-		g.rwLock.RLock()
-		if g.Closed() {
-			//连接池关闭，不塞回去，关闭通道避免内存泄漏
-			atomic.AddUint32(&g.bufferNumber, ^uint32(0))
-			err = BufferClosedError //错误赋值
-			buf.Close()             //及时关闭避免内存泄露
-		} else {
-			//塞回去
-			g.bufChan <- buf
-		}
-		g.rwLock.RUnlock()
-	}()
-	//尝试获取数据，此时buf只有一个线程操作，是安全的,出现错误则是因为通道被关闭
-	data, err = buf.Get()
-	if data != nil {
-		atomic.AddUint64(&g.total, ^uint64(0))
-		return data, nil
+	return buf, ok
+}
+
+// giveBack 减少被取出的缓冲器数量，leftover为关闭后需要保存的数据
+func (g *gurePool[T]) giveBack(leftover []T) {
+	g.borrowLock.Lock()
+	defer g.borrowLock.Unlock()
+	g.leftover = append(g.leftover, leftover...)
+	g.borrowed--
+	if g.borrowed == 0 {
+		g.returned.Broadcast()
 	}
-	if err != nil {
-		return
+}
+
+// release 关闭缓冲器，持久化时返回其中剩余的数据
+func (g *gurePool[T]) release(buf *gureBuffer[T]) []T {
+	var rest []T
+	for data, ok, _ := buf.Get(); g.persistent && ok; data, ok, _ = buf.Get() {
+		rest = append(rest, data)
+	}
+	buf.Close()
+	return rest
+}
+
+// returnBuffer 放回缓冲器，需要获得读锁，避免中途被关闭了
+func (g *gurePool[T]) returnBuffer(buf *gureBuffer[T]) error {
+	g.rwLock.RLock()
+	defer g.rwLock.RUnlock()
+	if g.Closed() {
+		//连接池关闭，不塞回去，关闭通道避免内存泄漏，持久化时剩余的数据交给关闭的协程保存
+		atomic.AddUint32(&g.bufferNumber, ^uint32(0))
+		g.giveBack(g.release(buf))
+		return BufferClosedError
+	}
+	g.bufChan <- buf
+	g.giveBack(nil)
+	return nil
+}
+
+// discardBuffer 移除取空的缓冲器
+func (g *gurePool[T]) discardBuffer(buf *gureBuffer[T]) {
+	buf.Close()
+	g.giveBack(nil)
+}
+
+// tryPut 将数据放入内存，无法放入时返回false
+func (g *gurePool[T]) tryPut(data T) (put bool, err error) {
+	if put, err = g.store(data); put {
+		atomic.AddUint64(&g.puts, 1)
+		g.notEmpty.broadcast()
 	}
-	*count++ //拿不到数据
 	return
 }
 
-func NewPool(bufferCap, bufferMaxNum uint32) Pool {
-	var gure = &gurePool{}
+// store 依次尝试每个缓冲器，全部已满时在数量上限内新增缓冲器，仍然无法放入时返回false
+func (g *gurePool[T]) store(data T) (put bool, err error) {
+	if g.Closed() {
+		return false, BufferClosedError
+	}
+	for i, n := uint32(0), g.BufferNum(); i < n; i++ {
+		buf, ok := g.takeBuffer()
+		if !ok {
+			return false, BufferClosedError
+		}
+		put, err = buf.Put(data)
+		if put { //写入成功,此时添加total，表示数据量+1
+			atomic.AddUint64(&g.total, 1)
+		}
+		//已经放入的数据在关闭时会随缓冲器一起处理
+		if returnErr := g.returnBuffer(buf); returnErr != nil && !put {
+			return false, returnErr
+		}
+		if put || err != nil {
+			return put, err
+		}
+	}
+	//判断是否需要新增buffer,写锁避免同时新增
+	g.rwLock.Lock()
+	defer g.rwLock.Unlock()
+	if g.Closed() {
+		return false, BufferClosedError
+	}
+	if g.BufferNum() >= g.MaxBufferNum() {
+		return false, nil
+	}
+	newBuf, _ := NewGureBuffer[T](g.bufferCap)
+	newBuf.Put(data)
+	g.bufChan <- newBuf
+	atomic.AddUint32(&g.bufferNumber, 1)
+	atomic.AddUint64(&g.total, 1)
+	return true, nil
+}
+
+// tryGet 依次尝试每个缓冲器，没有数据时ok为false
+// 数据量降到缓冲器总容量的一半以下时，移除取空的缓冲器
+func (g *gurePool[T]) tryGet() (data T, ok bool, err error) {
+	if g.Closed() {
+		return data, false, BufferClosedError
+	}
+	for i, n := uint32(0), g.BufferNum(); i < n; i++ {
+		buf, taken := g.takeBuffer()
+		if !taken {
+			return data, false, BufferClosedError
+		}
+		//尝试获取数据，此时buf只有一个线程操作，是安全的,出现错误则是因为通道被关闭
+		data, ok, err = buf.Get()
+		if ok {
+			atomic.AddUint64(&g.total, ^uint64(0))
+		}
+		if buf.Len() == 0 && g.shrink() {
+			g.discardBuffer(buf)
+		} else if returnErr := g.returnBuffer(buf); returnErr != nil && !ok {
+			//已经取出的数据仍然交给调用方
+			return data, false, returnErr
+		}
+		if ok || err != nil {
+			return data, ok, err
+		}
+	}
+	return data, false, nil
+}
+
+// shrink 判断是否可以移除一个缓冲器，可以时减少缓冲器数量并返回true
+func (g *gurePool[T]) shrink() bool {
+	for {
+		n := g.BufferNum()
+		if n <= 1 || g.Len() > uint64(n-1)*uint64(g.bufferCap)/2 {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(&g.bufferNumber, n, n-1) {
+			return true
+		}
+	}
+}
+
+// NewPool 创建阻塞策略的缓冲池
+func NewPool[T any](bufferCap, bufferMaxNum uint32) Pool[T] {
+	pool, _ := NewPoolWithConfig(PoolConfig[T]{BufferCap: bufferCap, MaxBufferNum: bufferMaxNum})
+	return pool
+}
+
+// NewPoolWithConfig 按照设置创建缓冲池
+func NewPoolWithConfig[T any](config PoolConfig[T]) (Pool[T], error) {
+	if config.MaxBufferNum == 0 {
+		return nil, ParameterIllegalError
+	}
+	var gure = &gurePool[T]{
+		policy:     config.Policy,
+		onDrop:     config.OnDrop,
+		onLost:     config.OnLost,
+		persistent: config.DataDir != "",
+	}
+	if gure.persistent && gure.policy == "" {
+		gure.policy = PolicySpill
+	}
+	switch gure.policy {
+	case "":
+		gure.policy = PolicyBlock
+	case PolicyBlock, PolicyDropOldest, PolicyDropNewest:
+		if gure.persistent {
+			return nil, ParameterIllegalError
+		}
+	case PolicySpill:
+		dir := config.SpillDir
+		if gure.persistent {
+			dir = config.DataDir
+		}
+		spill, err := newSpillQueue(dir, gure.persistent, config.SegmentSize, config.Codec)
+		if err != nil {
+			return nil, err
+		}
+		spill.onLost = gure.lose
+		gure.spill = spill
+		//重新打开数据目录时恢复之前的数据
+		gure.total = spill.Len()
+	default:
+		return nil, ParameterIllegalError
+	}
 	//额外添加部分空间
-	gure.bufferCap = bufferCap + EXTRA
-	gure.maxBufferNum = bufferMaxNum
+	gure.bufferCap = config.BufferCap + EXTRA
+	gure.maxBufferNum = config.MaxBufferNum
 	//通道缓冲数，额外添加一部分区域，用来减少阻塞
-	gure.bufChan = make(chan *gureBuffer, bufferMaxNum+EXTRA)
-	buffer, _ := NewGureBuffer(gure.bufferCap)
+	gure.bufChan = make(chan *gureBuffer[T], config.MaxBufferNum+EXTRA)
+	gure.returned = sync.NewCond(&gure.borrowLock)
+	buffer, _ := NewGureBuffer[T](gure.bufferCap)
 	gure.bufChan <- buffer
-	return gure
+	gure.bufferNumber = 1
+	return gure, nil
 }
@@ -0,0 +1,360 @@
+package kits
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type intCodec struct{}
+
+func (intCodec) Encode(data int) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+func (intCodec) Decode(b []byte) (int, error) {
+	var n int
+	err := json.Unmarshal(b, &n)
+	return n, err
+}
+
+func TestPool_Policy(t *testing.T) {
+	//缓冲器容量会额外加上EXTRA
+	block := NewPool[int](1, 1)
+	for i := 0; i < 1+EXTRA; i++ {
+		if err := block.Put(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := block.Put(ctx, -1); err != context.DeadlineExceeded {
+		t.Fatalf("put on full pool should block, got %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		block.Get(context.Background())
+	}()
+	if err := block.Put(context.Background(), -1); err != nil {
+		t.Fatal(err)
+	}
+	if stats := block.Stats(); stats.PutWaits != 2 || stats.PutWaitTime < 50*time.Millisecond || stats.Len != stats.Cap {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	var dropped []int
+	oldest, _ := NewPoolWithConfig(PoolConfig[int]{BufferCap: 1, MaxBufferNum: 1, Policy: PolicyDropOldest,
+		OnDrop: func(data int) { dropped = append(dropped, data) }})
+	for i := 0; i < 2+EXTRA; i++ {
+		oldest.Put(context.Background(), i)
+	}
+	if first, _, _ := oldest.TryGet(); first != 1 || len(dropped) != 1 || dropped[0] != 0 || oldest.Dropped() != 1 {
+		t.Errorf("drop-oldest should drop 0, got first %v dropped %v", first, dropped)
+	}
+
+	spill, err := NewPoolWithConfig(PoolConfig[int]{BufferCap: 1, MaxBufferNum: 1, Policy: PolicySpill,
+		SpillDir: t.TempDir(), Codec: intCodec{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+	const n = 50
+	for i := 0; i < n; i++ {
+		if err := spill.Put(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if spill.Len() != n {
+		t.Fatalf("len %d", spill.Len())
+	}
+	for i := 0; i < n; i++ {
+		if data, err := spill.Get(context.Background()); err != nil || data != i {
+			t.Fatalf("spill pool should keep order, got %v %v want %d", data, err, i)
+		}
+	}
+	if data, ok, err := spill.TryGet(); ok || err != nil {
+		t.Errorf("pool should be empty, got %v %v", data, err)
+	}
+}
+
+func TestPool_Refill(t *testing.T) {
+	pool, err := NewPoolWithConfig(PoolConfig[int]{BufferCap: 1, MaxBufferNum: 1, Policy: PolicySpill,
+		SpillDir: t.TempDir(), Codec: intCodec{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	spill := pool.(*gurePool[int]).spill
+	const n = 50
+	for i := 0; i < n; i++ {
+		pool.Put(context.Background(), i)
+	}
+	//内存取完后一次读回一个缓冲器容量的数据
+	for i := 0; i <= 1+EXTRA; i++ {
+		if data, err := pool.Get(context.Background()); err != nil || data != i {
+			t.Fatalf("got %v %v want %d", data, err, i)
+		}
+	}
+	if spill.Len() != n-2*(1+EXTRA) {
+		t.Fatalf("spill should be refilled in batches, %d left on disk", spill.Len())
+	}
+	//磁盘中还有数据时继续溢出，全部读回后重新放入内存
+	for i := 2 + EXTRA; i < n+10; i++ {
+		if i >= n-10 && i < n {
+			pool.Put(context.Background(), i+10)
+		}
+		if data, err := pool.Get(context.Background()); err != nil || data != i {
+			t.Fatalf("got %v %v want %d", data, err, i)
+		}
+	}
+	pool.Put(context.Background(), n+10)
+	if spill.Len() != 0 || pool.Len() != 1 {
+		t.Errorf("put after the spill drained should stay in memory, %d on disk", spill.Len())
+	}
+}
+
+func TestPool_Get(t *testing.T) {
+	pool := NewPool[string](1, 4)
+	//多个等待的协程各自取到一条数据
+	results := make(chan string, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			data, err := pool.Get(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			results <- data
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	for _, s := range []string{"a", "b", "c"} {
+		pool.Put(context.Background(), s)
+	}
+	got := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		got[<-results] = true
+	}
+	if len(got) != 3 {
+		t.Errorf("each waiter should get one value, got %v", got)
+	}
+	if stats := pool.Stats(); stats.Puts != 3 || stats.Gets != 3 || stats.GetWaits != 3 || stats.GetWaitTime <= 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Get(ctx); err != context.DeadlineExceeded {
+		t.Errorf("get on empty pool should wait for ctx, got %v", err)
+	}
+}
+
+func TestPool_Close(t *testing.T) {
+	pool := NewPool[int](1, 2)
+	done := make(chan error)
+	go func() {
+		_, err := pool.Get(context.Background())
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	pool.Close()
+	if err := <-done; err != BufferClosedError {
+		t.Errorf("get on closed pool should fail, got %v", err)
+	}
+	if pool.Close() {
+		t.Errorf("pool closed twice")
+	}
+}
+
+// oddCodec 无法解码奇数
+type oddCodec struct{ intCodec }
+
+func (c oddCodec) Decode(b []byte) (int, error) {
+	n, err := c.intCodec.Decode(b)
+	if err == nil && n%2 == 1 {
+		return 0, errors.New("odd value")
+	}
+	return n, err
+}
+
+func TestPool_Lost(t *testing.T) {
+	var lost uint64
+	pool, err := NewPoolWithConfig(PoolConfig[int]{BufferCap: 1, MaxBufferNum: 1, Policy: PolicySpill,
+		SpillDir: t.TempDir(), Codec: oddCodec{}, OnLost: func(n uint64, err error) { lost += n }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	for i := 0; i < 30; i++ {
+		pool.Put(context.Background(), i)
+	}
+	//无法还原的数据被跳过，不影响之后的数据
+	var got []int
+	for {
+		data, ok, err := pool.TryGet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, data)
+	}
+	//内存中容纳 1+EXTRA 个数据，溢出的奇数无法还原
+	if lost != 10 || pool.Dropped() != lost || pool.Len() != 0 || len(got) != 20 {
+		t.Errorf("got %d values, lost %d, dropped %d, len %d", len(got), lost, pool.Dropped(), pool.Len())
+	}
+	for _, data := range got {
+		if data%2 == 1 && data > EXTRA {
+			t.Errorf("spilled odd value %d should be lost", data)
+		}
+	}
+}
+
+func TestPool_DataDir(t *testing.T) {
+	dir := t.TempDir()
+	config := PoolConfig[int]{BufferCap: 1, MaxBufferNum: 1, DataDir: dir, SegmentSize: 64, Codec: intCodec{}}
+	pool, err := NewPoolWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 100
+	for i := 0; i < n; i++ {
+		if err := pool.Put(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//取出一部分，使读取位置跨过已经删除的分段
+	next := 0
+	for ; next < 40; next++ {
+		if data, err := pool.Get(context.Background()); err != nil || data != next {
+			t.Fatalf("got %v %v want %d", data, err, next)
+		}
+	}
+	pool.Close()
+	//重新打开后继续按顺序取出，包括关闭时内存中的数据
+	pool, err = NewPoolWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Len() != n-40 {
+		t.Fatalf("reopened pool should have %d values, got %d", n-40, pool.Len())
+	}
+	for ; next < 70; next++ {
+		if data, err := pool.Get(context.Background()); err != nil || data != next {
+			t.Fatalf("got %v %v want %d", data, err, next)
+		}
+	}
+	pool.Put(context.Background(), n)
+	pool.Close()
+	pool, err = NewPoolWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	for ; next <= n; next++ {
+		if data, err := pool.Get(context.Background()); err != nil || data != next {
+			t.Fatalf("got %v %v want %d", data, err, next)
+		}
+	}
+	if pool.Len() != 0 {
+		t.Errorf("pool should be empty, got %d", pool.Len())
+	}
+
+	//最后一个分段中写了一半的记录在重新打开时被截断
+	config.DataDir = t.TempDir()
+	torn, _ := NewPoolWithConfig(config)
+	for i := 0; i < 20; i++ {
+		torn.Put(context.Background(), i)
+	}
+	torn.Close()
+	segments, _ := filepath.Glob(filepath.Join(config.DataDir, "*"+segmentSuffix))
+	file, _ := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0644)
+	file.Write([]byte{9, 0, 0, 0, 1})
+	file.Close()
+	torn, err = NewPoolWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer torn.Close()
+	if torn.Len() != 20 {
+		t.Errorf("torn record should be dropped, got %d values", torn.Len())
+	}
+}
+
+func TestPool_Corrupted(t *testing.T) {
+	var lost uint64
+	config := PoolConfig[int]{BufferCap: 1, MaxBufferNum: 1, DataDir: t.TempDir(), SegmentSize: 64, Codec: intCodec{},
+		OnLost: func(n uint64, err error) { lost += n }}
+	pool, _ := NewPoolWithConfig(config)
+	for i := 0; i < 40; i++ {
+		pool.Put(context.Background(), i)
+	}
+	pool.Close()
+	segments, _ := filepath.Glob(filepath.Join(config.DataDir, "*"+segmentSuffix))
+	if len(segments) < 3 {
+		t.Fatalf("expected several segments, got %d", len(segments))
+	}
+	//第一个分段中的一条记录内容损坏，第二个分段中的记录长度损坏
+	file, _ := os.OpenFile(segments[0], os.O_WRONLY, 0644)
+	file.WriteAt([]byte{'x'}, recordHeaderSize)
+	file.Close()
+	file, _ = os.OpenFile(segments[1], os.O_WRONLY, 0644)
+	file.WriteAt([]byte{0xff, 0xff, 0xff, 0x7f}, 0)
+	file.Close()
+	pool, err := NewPoolWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	total := pool.Len()
+	var got uint64
+	for {
+		_, ok, err := pool.TryGet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got++
+	}
+	if lost == 0 || got+lost != total || pool.Len() != 0 || pool.Dropped() != lost {
+		t.Errorf("got %d of %d values, lost %d, len %d", got, total, lost, pool.Len())
+	}
+}
+
+func TestPool_CloseWhilePut(t *testing.T) {
+	config := PoolConfig[int]{BufferCap: 4, MaxBufferNum: 2, DataDir: t.TempDir(), Codec: intCodec{}}
+	pool, _ := NewPoolWithConfig(config)
+	var puts int64
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				if pool.Put(context.Background(), w*1000+i) != nil {
+					return
+				}
+				atomic.AddInt64(&puts, 1)
+			}
+		}(w)
+	}
+	time.Sleep(20 * time.Millisecond)
+	pool.Close()
+	wg.Wait()
+	//关闭时正在使用的缓冲器中的数据同样被保存
+	reopened, err := NewPoolWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopened.Len() != uint64(atomic.LoadInt64(&puts)) {
+		t.Errorf("saved %d values, put %d", reopened.Len(), puts)
+	}
+}
@@ -0,0 +1,100 @@
+package kits
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+)
+
+// suffixListError 公共后缀列表格式错误
+var suffixListError = errors.New("public suffix list corrupted")
+
+// SuffixList 公共后缀列表，用于计算可注册域名，例如 shop.example.co.uk 的可注册域名为 example.co.uk
+// 未命中任何规则时，按照默认规则将最后一级视为公共后缀
+type SuffixList struct {
+	//普通规则
+	rules map[string]struct{}
+	//通配规则，保存 * 之后的部分
+	wildcards map[string]struct{}
+	//例外规则，保存 ! 之后的部分
+	exceptions map[string]struct{}
+}
+
+// ParseSuffixList 解析 publicsuffix.org 格式的公共后缀列表
+func ParseSuffixList(r io.Reader) (*SuffixList, error) {
+	if r == nil {
+		return nil, ParameterIllegalError
+	}
+	l := &SuffixList{
+		rules:      map[string]struct{}{},
+		wildcards:  map[string]struct{}{},
+		exceptions: map[string]struct{}{},
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		//每行只取第一个空白之前的部分
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule := strings.ToLower(fields[0])
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			l.exceptions[rule[1:]] = struct{}{}
+		case strings.HasPrefix(rule, "*."):
+			l.wildcards[rule[2:]] = struct{}{}
+		case strings.Contains(rule, "*"):
+			return nil, suffixListError
+		default:
+			l.rules[rule] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// PublicSuffix 返回域名的公共后缀，例外规则优先，其余规则取最长匹配
+func (l *SuffixList) PublicSuffix(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	labels := strings.Split(domain, ".")
+	for i := range labels {
+		suffix := strings.Join(labels[i:], ".")
+		if _, ok := l.exceptions[suffix]; ok {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if _, ok := l.rules[suffix]; ok {
+			return suffix
+		}
+		if i+1 < len(labels) {
+			if _, ok := l.wildcards[strings.Join(labels[i+1:], ".")]; ok {
+				return suffix
+			}
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+// RegistrableDomain 返回域名的可注册域名，即公共后缀再加一级
+// IP地址原样返回，域名本身就是公共后缀时返回错误
+func (l *SuffixList) RegistrableDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if domain == "" {
+		return "", ParameterIllegalError
+	}
+	if net.ParseIP(domain) != nil {
+		return domain, nil
+	}
+	suffix := l.PublicSuffix(domain)
+	if len(suffix) >= len(domain) {
+		return "", errors.New("domain " + domain + " is a public suffix")
+	}
+	rest := domain[:len(domain)-len(suffix)-1]
+	if i := strings.LastIndexByte(rest, '.'); i >= 0 {
+		rest = rest[i+1:]
+	}
+	return rest + "." + suffix, nil
+}
@@ -0,0 +1,39 @@
+package kits
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSuffixList_RegistrableDomain(t *testing.T) {
+	file, err := os.Open("testdata/public_suffix_list.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	list, err := ParseSuffixList(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"www.example.com":      "example.com",
+		"shop.example.co.uk":   "example.co.uk",
+		"user.github.io":       "user.github.io",
+		"a.b.example.ck":       "b.example.ck",
+		"www.ck":               "www.ck",
+		"Example.COM.":         "example.com",
+		"127.0.0.1":            "127.0.0.1",
+		"deep.sub.example.org": "example.org",
+	}
+	for domain, want := range cases {
+		got, err := list.RegistrableDomain(domain)
+		if err != nil || got != want {
+			t.Errorf("RegistrableDomain(%s) = %s, %v, want %s", domain, got, err, want)
+		}
+	}
+	for _, domain := range []string{"com", "co.uk", "github.io", "example.ck"} {
+		if _, err := list.RegistrableDomain(domain); err == nil {
+			t.Errorf("public suffix %s should have no registrable domain", domain)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+package kits
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultSegmentSize 默认的分段文件大小，写满后创建新的分段
+	DefaultSegmentSize = 64 << 20
+	// segmentSuffix 分段文件的后缀，文件名为分段序号
+	segmentSuffix = ".seg"
+	// cursorFileName 保存读取位置的文件名
+	cursorFileName = "cursor"
+	// recordHeaderSize 每条记录的头部大小，依次为内容长度与CRC32校验值
+	recordHeaderSize = 8
+)
+
+var spillCorruptedError = errors.New("spill segment corrupted")
+
+// Codec 数据的编码方式，溢出到磁盘的数据需要编码后保存
+type Codec[T any] interface {
+	// Encode 将数据编码为字节
+	Encode(data T) ([]byte, error)
+	// Decode 从字节中还原数据
+	Decode(b []byte) (T, error)
+}
+
+// spillQueue 保存在磁盘分段文件中的先进先出队列
+// 每条数据以长度、校验值加编码后的内容追加写入当前分段，分段写满后创建新的分段
+// 读取完的分段会被删除，全部读取后清空目录，持久化时读取位置保存在cursor文件中
+type spillQueue[T any] struct {
+	lock  sync.Mutex
+	dir   string
+	codec Codec[T]
+	//persistent 为true时关闭后保留数据，否则关闭时删除目录
+	persistent  bool
+	segmentSize int64
+	//正在读取的分段及下一条数据的读取位置
+	readSeq uint64
+	readOff int64
+	reader  *os.File
+	//正在写入的分段及下一条数据的写入位置
+	writeSeq uint64
+	writeOff int64
+	writer   *os.File
+	//队列中的数据数量
+	count  uint64
+	closed bool
+	//数据无法还原时的回调，在不持有锁时调用
+	onLost func(n uint64, err error)
+}
+
+// newSpillQueue 创建溢出队列
+// persistent 为false时在dir中创建临时目录，dir为空时使用系统临时目录，关闭时删除
+// persistent 为true时直接使用dir，打开已有的分段继续读取
+func newSpillQueue[T any](dir string, persistent bool, segmentSize int64, codec Codec[T]) (*spillQueue[T], error) {
+	if codec == nil || persistent && dir == "" {
+		return nil, ParameterIllegalError
+	}
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	s := &spillQueue[T]{codec: codec, persistent: persistent, segmentSize: segmentSize}
+	if !persistent {
+		tmp, err := os.MkdirTemp(dir, "gure-spill-*")
+		if err != nil {
+			return nil, fmt.Errorf("create spill dir fail with %v", err)
+		}
+		s.dir = tmp
+		return s, nil
+	}
+	s.dir = dir
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("open spill dir fail with %v", err)
+	}
+	return s, nil
+}
+
+func (s *spillQueue[T]) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+// load 读取cursor与已有的分段，统计数据数量，最后一个分段中不完整的记录会被截断
+func (s *spillQueue[T]) load() error {
+	var cursor [16]byte
+	if b, err := os.ReadFile(filepath.Join(s.dir, cursorFileName)); err == nil && len(b) == len(cursor) {
+		copy(cursor[:], b)
+		s.readSeq = binary.LittleEndian.Uint64(cursor[:8])
+		s.readOff = int64(binary.LittleEndian.Uint64(cursor[8:]))
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	var seqs []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		//读取位置之前的分段已经读取完毕，删除时中断才会残留
+		if seq < s.readSeq {
+			os.Remove(s.segmentPath(seq))
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	if len(seqs) == 0 {
+		s.readOff = 0
+		s.writeSeq = s.readSeq
+		return nil
+	}
+	if seqs[0] != s.readSeq {
+		//读取位置所在的分段已经删除，从下一个分段开头继续
+		s.readSeq, s.readOff = seqs[0], 0
+	}
+	for i, seq := range seqs {
+		offset := int64(0)
+		if seq == s.readSeq {
+			offset = s.readOff
+		}
+		n, end, err := s.scan(seq, offset, i == len(seqs)-1)
+		if err != nil {
+			return err
+		}
+		s.count += n
+		s.writeSeq, s.writeOff = seq, end
+	}
+	return nil
+}
+
+// scan 统计分段中从offset开始的记录数量，返回有效数据的结尾
+// last 为true时校验每条记录，在第一条不完整或者校验失败的记录处截断
+// 其他分段只统计损坏之前的记录，读取到损坏处时跳过分段剩余的部分
+func (s *spillQueue[T]) scan(seq uint64, offset int64, last bool) (uint64, int64, error) {
+	file, err := os.OpenFile(s.segmentPath(seq), os.O_RDWR, 0644)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	var count uint64
+	var header [recordHeaderSize]byte
+	for offset < info.Size() {
+		if _, err = file.ReadAt(header[:], offset); err != nil {
+			break
+		}
+		size := int64(binary.LittleEndian.Uint32(header[:4]))
+		if offset+recordHeaderSize+size > info.Size() {
+			break
+		}
+		if last {
+			b := make([]byte, size)
+			if _, err = file.ReadAt(b, offset+recordHeaderSize); err != nil || crc32.ChecksumIEEE(b) != binary.LittleEndian.Uint32(header[4:]) {
+				break
+			}
+		}
+		offset += recordHeaderSize + size
+		count++
+	}
+	if offset < info.Size() && last {
+		if err = file.Truncate(offset); err != nil {
+			return 0, 0, err
+		}
+	}
+	return count, offset, nil
+}
+
+// saveCursor 保存读取位置，先写入临时文件再替换，调用方需要持有锁
+func (s *spillQueue[T]) saveCursor() error {
+	if !s.persistent {
+		return nil
+	}
+	var cursor [16]byte
+	binary.LittleEndian.PutUint64(cursor[:8], s.readSeq)
+	binary.LittleEndian.PutUint64(cursor[8:], uint64(s.readOff))
+	path := filepath.Join(s.dir, cursorFileName)
+	if err := os.WriteFile(path+".tmp", cursor[:], 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// encode 将数据编码为记录
+func (s *spillQueue[T]) encode(data T) ([]byte, error) {
+	b, err := s.codec.Encode(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode spilled data fail with %v", err)
+	}
+	record := make([]byte, recordHeaderSize+len(b))
+	binary.LittleEndian.PutUint32(record[:4], uint32(len(b)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(b))
+	copy(record[recordHeaderSize:], b)
+	return record, nil
+}
+
+func (s *spillQueue[T]) Push(data T) error {
+	record, err := s.encode(data)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return BufferClosedError
+	}
+	//当前分段写满后创建新的分段
+	if s.writer != nil && s.writeOff >= s.segmentSize {
+		s.writer.Close()
+		s.writer = nil
+		s.writeSeq++
+		s.writeOff = 0
+	}
+	if s.writer == nil {
+		if s.writer, err = os.OpenFile(s.segmentPath(s.writeSeq), os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			return fmt.Errorf("open spill segment fail with %v", err)
+		}
+	}
+	if _, err = s.writer.WriteAt(record, s.writeOff); err != nil {
+		return fmt.Errorf("write spill segment fail with %v", err)
+	}
+	s.writeOff += int64(len(record))
+	s.count++
+	return nil
+}
+
+// Pop 取出最早写入的数据，队列为空时ok为false
+// 校验失败或者无法解码的数据作为丢失处理，继续读取下一条
+func (s *spillQueue[T]) Pop() (data T, ok bool, err error) {
+	for {
+		s.lock.Lock()
+		b, lost, err := s.next()
+		s.lock.Unlock()
+		s.lose(lost, spillCorruptedError)
+		if b == nil || err != nil {
+			var zero T
+			return zero, false, err
+		}
+		if data, err = s.codec.Decode(b); err == nil {
+			return data, true, nil
+		}
+		s.lose(1, fmt.Errorf("decode spilled data fail with %v", err))
+	}
+}
+
+// lose 报告丢失的数据
+func (s *spillQueue[T]) lose(n uint64, err error) {
+	if s.onLost != nil && n > 0 {
+		s.onLost(n, err)
+	}
+}
+
+// next 读取下一条记录的内容，读完的分段会被删除，调用方需要持有锁
+// 校验失败的记录会被跳过，记录长度损坏时跳过分段剩余的部分，lost为因此丢失的数据数量
+func (s *spillQueue[T]) next() (b []byte, lost uint64, err error) {
+	if s.closed {
+		return nil, 0, BufferClosedError
+	}
+	var header [recordHeaderSize]byte
+	for s.count > 0 {
+		if s.reader == nil {
+			reader, err := os.Open(s.segmentPath(s.readSeq))
+			if err != nil {
+				return nil, lost, fmt.Errorf("open spill segment fail with %v", err)
+			}
+			s.reader = reader
+		}
+		if _, err = s.reader.ReadAt(header[:], s.readOff); err != nil {
+			if err != io.EOF || s.readSeq >= s.writeSeq {
+				return nil, lost, fmt.Errorf("read spill segment fail with %v", err)
+			}
+			//当前分段已经读完，删除后读取下一个分段
+			if err = s.nextSegment(); err != nil {
+				return nil, lost, err
+			}
+			continue
+		}
+		end := s.readOff + recordHeaderSize + int64(binary.LittleEndian.Uint32(header[:4]))
+		if end > s.segmentEnd() {
+			//无法定位下一条记录，跳过分段剩余的部分
+			n, err := s.skipSegment()
+			lost += n
+			if err != nil {
+				return nil, lost, err
+			}
+			continue
+		}
+		b = make([]byte, end-s.readOff-recordHeaderSize)
+		if _, err = s.reader.ReadAt(b, s.readOff+recordHeaderSize); err != nil {
+			return nil, lost, fmt.Errorf("read spill segment fail with %v", err)
+		}
+		s.readOff = end
+		s.count--
+		//全部读取后删除所有分段，避免文件无限增长
+		if s.count == 0 {
+			if err = s.reset(); err != nil {
+				return nil, lost, err
+			}
+		}
+		if crc32.ChecksumIEEE(b) == binary.LittleEndian.Uint32(header[4:]) {
+			return b, lost, nil
+		}
+		lost++
+	}
+	return nil, lost, nil
+}
+
+// segmentEnd 正在读取的分段中有效数据的结尾，调用方需要持有锁
+func (s *spillQueue[T]) segmentEnd() int64 {
+	if s.readSeq == s.writeSeq {
+		return s.writeOff
+	}
+	info, err := s.reader.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// nextSegment 删除读完的分段，从下一个分段开头读取，调用方需要持有锁
+func (s *spillQueue[T]) nextSegment() error {
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	os.Remove(s.segmentPath(s.readSeq))
+	s.readSeq++
+	s.readOff = 0
+	return s.saveCursor()
+}
+
+// skipSegment 跳过正在读取的分段剩余的部分，返回丢失的数据数量，调用方需要持有锁
+func (s *spillQueue[T]) skipSegment() (uint64, error) {
+	var rest uint64
+	for seq := s.readSeq + 1; seq <= s.writeSeq; seq++ {
+		rest += s.countRecords(seq)
+	}
+	var lost uint64
+	if s.count > rest {
+		lost = s.count - rest
+	}
+	s.count = rest
+	//正在写入的分段损坏时从新的分段开始
+	if rest == 0 || s.readSeq >= s.writeSeq {
+		return lost, s.reset()
+	}
+	return lost, s.nextSegment()
+}
+
+// countRecords 按照记录长度统计分段中的记录数量，不校验内容，调用方需要持有锁
+func (s *spillQueue[T]) countRecords(seq uint64) uint64 {
+	file, err := os.Open(s.segmentPath(seq))
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+	size := info.Size()
+	if seq == s.writeSeq {
+		size = s.writeOff
+	}
+	var count uint64
+	var header [recordHeaderSize]byte
+	for offset := int64(0); offset+recordHeaderSize <= size; count++ {
+		if _, err = file.ReadAt(header[:], offset); err != nil {
+			break
+		}
+		offset += recordHeaderSize + int64(binary.LittleEndian.Uint32(header[:4]))
+		if offset > size {
+			break
+		}
+	}
+	return count
+}
+
+// reset 删除所有分段，从新的分段开始写入，调用方需要持有锁
+func (s *spillQueue[T]) reset() error {
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	if s.writer != nil {
+		s.writer.Close()
+		s.writer = nil
+	}
+	for seq := s.readSeq; seq <= s.writeSeq; seq++ {
+		if err := os.Remove(s.segmentPath(seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	s.writeSeq++
+	s.readSeq, s.readOff, s.writeOff = s.writeSeq, 0, 0
+	return s.saveCursor()
+}
+
+// Compact 将head放在队列最前面，与当前分段中未读取的记录一起重写为新的分段
+// 用于关闭缓冲池时保存内存中的数据，重写完成后读取位置回到分段开头
+func (s *spillQueue[T]) Compact(head []T) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return BufferClosedError
+	}
+	if len(head) == 0 {
+		return nil
+	}
+	tmp, err := os.CreateTemp(s.dir, "compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	var size int64
+	for _, data := range head {
+		record, err := s.encode(data)
+		if err != nil {
+			return err
+		}
+		if _, err = tmp.Write(record); err != nil {
+			return err
+		}
+		size += int64(len(record))
+	}
+	if s.count > 0 {
+		//追加当前分段中未读取的部分
+		segment, err := os.Open(s.segmentPath(s.readSeq))
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(tmp, io.NewSectionReader(segment, s.readOff, 1<<62))
+		segment.Close()
+		if err != nil {
+			return err
+		}
+		size += n
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	if s.writer != nil && s.writeSeq == s.readSeq {
+		s.writer.Close()
+		s.writer = nil
+	}
+	if err = os.Rename(tmp.Name(), s.segmentPath(s.readSeq)); err != nil {
+		return err
+	}
+	if s.writeSeq == s.readSeq {
+		s.writeOff = size
+	}
+	s.readOff = 0
+	s.count += uint64(len(head))
+	return s.saveCursor()
+}
+
+func (s *spillQueue[T]) Len() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.count
+}
+
+// Close 关闭队列，持久化时同步文件并保存读取位置，否则删除目录，其中的数据会被丢弃
+func (s *spillQueue[T]) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.reader != nil {
+		s.reader.Close()
+	}
+	if s.writer != nil {
+		if s.persistent {
+			err = s.writer.Sync()
+		}
+		s.writer.Close()
+	}
+	if !s.persistent {
+		return os.RemoveAll(s.dir)
+	}
+	if cursorErr := s.saveCursor(); err == nil {
+		err = cursorErr
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package kits
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// VisitedSet 已访问集合，用于链接去重，要求并发安全
+type VisitedSet interface {
+	// Add 添加键，返回true表示键之前不存在
+	Add(key string) (bool, error)
+
+	// Contains 判断键是否已经存在
+	Contains(key string) (bool, error)
+
+	// Len 已添加的键数量
+	Len() uint64
+
+	// Snapshot 将集合以JSON格式写入w，用于断点保存
+	Snapshot(w io.Writer) error
+
+	// Restore 从Snapshot写入的数据中恢复集合
+	Restore(r io.Reader) error
+
+	// Close 关闭集合，释放占用的资源
+	Close() error
+}
+
+// mapVisitedSet 基于内存字典的已访问集合，准确但内存占用随链接数量增长
+type mapVisitedSet struct {
+	keys   map[string]struct{}
+	rwLock sync.RWMutex
+}
+
+func (m *mapVisitedSet) Add(key string) (bool, error) {
+	m.rwLock.Lock()
+	defer m.rwLock.Unlock()
+	if _, ok := m.keys[key]; ok {
+		return false, nil
+	}
+	m.keys[key] = struct{}{}
+	return true, nil
+}
+
+func (m *mapVisitedSet) Contains(key string) (bool, error) {
+	m.rwLock.RLock()
+	defer m.rwLock.RUnlock()
+	_, ok := m.keys[key]
+	return ok, nil
+}
+
+func (m *mapVisitedSet) Len() uint64 {
+	m.rwLock.RLock()
+	defer m.rwLock.RUnlock()
+	return uint64(len(m.keys))
+}
+
+func (m *mapVisitedSet) Snapshot(w io.Writer) error {
+	m.rwLock.RLock()
+	keys := make([]string, 0, len(m.keys))
+	for key := range m.keys {
+		keys = append(keys, key)
+	}
+	m.rwLock.RUnlock()
+	return json.NewEncoder(w).Encode(keys)
+}
+
+func (m *mapVisitedSet) Restore(r io.Reader) error {
+	var keys []string
+	if err := json.NewDecoder(r).Decode(&keys); err != nil {
+		return err
+	}
+	m.rwLock.Lock()
+	defer m.rwLock.Unlock()
+	for _, key := range keys {
+		m.keys[key] = struct{}{}
+	}
+	return nil
+}
+
+func (m *mapVisitedSet) Close() error {
+	return nil
+}
+
+// NewMapVisitedSet 创建基于内存字典的已访问集合
+func NewMapVisitedSet() VisitedSet {
+	return &mapVisitedSet{keys: map[string]struct{}{}}
+}
@@ -0,0 +1,89 @@
+package kits
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestVisitedSet(t *testing.T) {
+	bloom, err := NewBloomVisitedSet(100, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk, err := NewDiskVisitedSet(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	sets := map[string]VisitedSet{"map": NewMapVisitedSet(), "bloom": bloom, "disk": disk}
+	//数量超过布隆过滤器初始容量以及磁盘集合初始槽位的一半，触发扩容
+	const n = 40000
+	for name, set := range sets {
+		for i := 0; i < n; i++ {
+			added, err := set.Add(fmt.Sprintf("http://example.com/%d", i))
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if !added && name != "bloom" {
+				t.Fatalf("%s: key %d should be new", name, i)
+			}
+		}
+		for i := 0; i < n; i++ {
+			if ok, _ := set.Contains(fmt.Sprintf("http://example.com/%d", i)); !ok {
+				t.Fatalf("%s: key %d should exist", name, i)
+			}
+			if added, _ := set.Add(fmt.Sprintf("http://example.com/%d", i)); added {
+				t.Fatalf("%s: key %d added twice", name, i)
+			}
+		}
+		if name != "bloom" && set.Len() != n {
+			t.Errorf("%s: len %d", name, set.Len())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = bloom.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := NewBloomVisitedSet(100, 0.01)
+	if err = restored.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := restored.Contains("http://example.com/1"); !ok || restored.Len() != bloom.Len() {
+		t.Errorf("bloom filter not restored")
+	}
+}
+
+func TestDiskVisitedSet_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	set, err := NewDiskVisitedSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Add("http://example.com/")
+	set.Close()
+	set, err = NewDiskVisitedSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Close()
+	if ok, _ := set.Contains("http://example.com/"); !ok || set.Len() != 1 {
+		t.Errorf("disk visited set not reopened")
+	}
+	//恢复快照后，快照之后添加的键不再存在
+	var buf bytes.Buffer
+	if err = set.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	set.Add("http://example.com/after")
+	if err = set.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := set.Contains("http://example.com/after"); ok || set.Len() != 1 {
+		t.Errorf("keys added after snapshot should be discarded, len %d", set.Len())
+	}
+	if ok, _ := set.Contains("http://example.com/"); !ok {
+		t.Errorf("snapshot keys should be kept")
+	}
+}
@@ -13,3 +13,14 @@ type Analyzer interface {
 
 // ParseResponse 解析响应的函数类型
 type ParseResponse func(resp *http.Response, respDepth uint32) ([]Data, []error)
+
+// AnalyzerMiddleware 解析器中间件，用于在解析之前检查响应，在解析之后过滤或者改写得到的数据
+//要求并发安全
+type AnalyzerMiddleware interface {
+	// BeforeParse 解析之前按照注册顺序调用，可以检查或者修改响应
+	//返回false时跳过解析以及之后的中间件，返回的错误会交给调度器
+	BeforeParse(resp *Response) (bool, error)
+
+	// AfterParse 解析之后按照相反的顺序调用，可以过滤、改写或者追加请求与条目
+	AfterParse(resp *Response, dataList []Data) ([]Data, []error)
+}
@@ -7,4 +7,5 @@ const (
 	AnalyzerError   ErrorType = "analyzer error"
 	PipelineError   ErrorType = "pipeline error"
 	SchedulerError  ErrorType = "scheduler error"
+	RobotsError     ErrorType = "robots error"
 )
@@ -1,5 +1,13 @@
 package module
 
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrRequestDropped 下载器中间件丢弃请求时返回的错误，调度器不会重试也不会记录为死信
+var ErrRequestDropped = errors.New("request dropped by downloader middleware")
+
 // DownLoader 下载器模块
 //要求并发安全
 type DownLoader interface {
@@ -8,3 +16,30 @@ type DownLoader interface {
 	// Download 下载方法
 	Download(req *Request) (*Response, error)
 }
+
+// CookieJars 按照会话提供Cookie存储，每个会话的Cookie互相独立
+type CookieJars interface {
+	// Jar 返回会话使用的Cookie存储，会话不存在时创建
+	Jar(slot string) http.CookieJar
+}
+
+// SessionDownloader 可以使用调度器管理的Cookie存储的下载器
+//设置后按照请求所属的会话选择Cookie存储，代替http客户端自带的Jar
+type SessionDownloader interface {
+	SetCookieJars(jars CookieJars)
+}
+
+// DownloaderMiddleware 下载器中间件，按照注册顺序处理请求，按照相反的顺序处理响应与错误
+//要求并发安全
+type DownloaderMiddleware interface {
+	// ProcessRequest 下载之前调用，可以修改请求
+	//返回非空响应时跳过之后的中间件与下载，响应交给之前的中间件处理，返回ErrRequestDropped时丢弃请求
+	ProcessRequest(req *Request) (*Response, error)
+
+	// ProcessResponse 收到响应后调用，可以修改或者替换响应，替换时需要关闭原来的响应体
+	ProcessResponse(req *Request, resp *Response) (*Response, error)
+
+	// ProcessError 下载或者之后的中间件出错时调用，返回非空响应表示恢复，否则返回原来的或者新的错误
+	//之后的中间件丢弃请求时同样会调用，用于清理状态，此时返回的响应会被忽略
+	ProcessError(req *Request, err error) (*Response, error)
+}
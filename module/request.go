@@ -1,6 +1,11 @@
 package module
 
-import "net/http"
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
 
 //请求的数据类型
 type Request struct {
@@ -8,6 +13,18 @@ type Request struct {
 	httpReq *http.Request
 	//爬取深度
 	depth uint32
+	//优先级，数值越大越先被下载
+	priority int32
+	//已经尝试下载的次数
+	attempt uint32
+	//可重复读取的请求体
+	body []byte
+	//自定义的请求指纹，为空时由调度器计算
+	fingerprint string
+	//发现该请求的页面链接，种子请求为空
+	parent string
+	//请求所属的会话，不同会话使用不同的Cookie，为空时使用默认会话
+	session string
 }
 
 func (req *Request) Valid() bool {
@@ -28,3 +45,166 @@ func (req *Request) HTTPRep() *http.Request {
 func (req *Request) Depth() uint32 {
 	return req.depth
 }
+
+// Priority 获取请求优先级
+func (req *Request) Priority() int32 {
+	return req.priority
+}
+
+// SetPriority 设置请求优先级，解析方法可以借此让重要的页面先被下载
+func (req *Request) SetPriority(priority int32) {
+	req.priority = priority
+}
+
+// Attempt 获取已经尝试下载的次数
+func (req *Request) Attempt() uint32 {
+	return req.attempt
+}
+
+// SetAttempt 设置已经尝试下载的次数
+func (req *Request) SetAttempt(attempt uint32) {
+	req.attempt = attempt
+}
+
+// Body 获取请求体，请求体只会被读取一次，之后可以重复获取
+func (req *Request) Body() ([]byte, error) {
+	if req.body != nil {
+		return req.body, nil
+	}
+	httpReq := req.httpReq
+	var reader io.ReadCloser
+	var err error
+	switch {
+	case httpReq.GetBody != nil:
+		reader, err = httpReq.GetBody()
+	case httpReq.Body != nil && httpReq.Body != http.NoBody:
+		//只能读取一次的请求体，读取后替换为可重复读取的形式
+		reader = httpReq.Body
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBody(body)
+	return body, nil
+}
+
+// SetBody 设置可重复读取的请求体
+func (req *Request) SetBody(body []byte) {
+	if body == nil {
+		body = []byte{}
+	}
+	req.body = body
+	httpReq := req.httpReq
+	httpReq.ContentLength = int64(len(body))
+	httpReq.GetBody = func() (io.ReadCloser, error) {
+		//空请求体需要使用NoBody，否则会被当作长度未知的请求体发送
+		if len(body) == 0 {
+			return http.NoBody, nil
+		}
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	httpReq.Body, _ = httpReq.GetBody()
+}
+
+// RewindBody 将请求体重置到开头，重新下载之前需要调用
+func (req *Request) RewindBody() error {
+	if req.httpReq.GetBody == nil {
+		return nil
+	}
+	body, err := req.httpReq.GetBody()
+	if err != nil {
+		return err
+	}
+	req.httpReq.Body = body
+	return nil
+}
+
+// Fingerprint 获取自定义的请求指纹，未设置时为空
+func (req *Request) Fingerprint() string {
+	return req.fingerprint
+}
+
+// SetFingerprint 设置自定义的请求指纹，指纹相同的请求只会被下载一次
+func (req *Request) SetFingerprint(fingerprint string) {
+	req.fingerprint = fingerprint
+}
+
+// Parent 获取发现该请求的页面链接，种子请求为空
+func (req *Request) Parent() string {
+	return req.parent
+}
+
+// SetParent 设置发现该请求的页面链接，解析器会为解析得到的请求自动设置
+func (req *Request) SetParent(parent string) {
+	req.parent = parent
+}
+
+// Session 获取请求所属的会话
+func (req *Request) Session() string {
+	return req.session
+}
+
+// SetSession 设置请求所属的会话，解析得到的请求默认与发现它的页面属于同一个会话
+func (req *Request) SetSession(session string) {
+	req.session = session
+}
+
+// RequestRecord 请求的可序列化形式，用于断点保存与恢复
+type RequestRecord struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	Header      http.Header `json:"header,omitempty"`
+	Depth       uint32      `json:"depth"`
+	Priority    int32       `json:"priority,omitempty"`
+	Attempt     uint32      `json:"attempt,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	Fingerprint string      `json:"fingerprint,omitempty"`
+	Parent      string      `json:"parent,omitempty"`
+	Session     string      `json:"session,omitempty"`
+}
+
+// Record 将请求转换为可序列化的记录
+func (req *Request) Record() RequestRecord {
+	httpReq := req.httpReq
+	body, _ := req.Body()
+	return RequestRecord{
+		Method:      httpReq.Method,
+		URL:         httpReq.URL.String(),
+		Header:      httpReq.Header.Clone(),
+		Depth:       req.depth,
+		Priority:    req.priority,
+		Attempt:     req.attempt,
+		Body:        body,
+		Fingerprint: req.fingerprint,
+		Parent:      req.parent,
+		Session:     req.session,
+	}
+}
+
+// Request 根据记录重新构造请求
+func (r RequestRecord) Request() (*Request, error) {
+	httpReq, err := http.NewRequest(r.Method, r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.Header != nil {
+		httpReq.Header = r.Header.Clone()
+	}
+	req := NewRequest(httpReq, r.Depth)
+	req.SetPriority(r.Priority)
+	req.SetAttempt(r.Attempt)
+	req.SetFingerprint(r.Fingerprint)
+	req.SetParent(r.Parent)
+	req.SetSession(r.Session)
+	if len(r.Body) > 0 {
+		req.SetBody(r.Body)
+	}
+	return req, nil
+}
@@ -2,10 +2,23 @@ package module
 
 import "net/http"
 
+const (
+	// CacheStatusHeader 从缓存返回的响应会带上该响应头，取值为 CacheHit 或 CacheRevalidated
+	CacheStatusHeader = "X-Gure-Cache"
+	// CacheHit 响应直接从缓存中读取
+	CacheHit = "hit"
+	// CacheRevalidated 缓存经过条件请求确认仍然有效
+	CacheRevalidated = "revalidated"
+)
+
 // Response 数据响应
 type Response struct {
 	httpResp *http.Response
 	depth    uint32
+	//响应所属的会话，与对应的请求相同
+	session string
+	//对应请求的指纹，调度器在响应解析完成后才将请求移出待爬取请求
+	fingerprint string
 }
 
 func (resp *Response) Valid() bool {
@@ -21,7 +34,32 @@ func (resp *Response) HTTPResp() *http.Response {
 	return resp.httpResp
 }
 
+// FromCache 判断响应是否直接从缓存中读取，没有发出请求
+func (resp *Response) FromCache() bool {
+	return resp.httpResp != nil && resp.httpResp.Header.Get(CacheStatusHeader) == CacheHit
+}
+
 // Depth 获取响应深度
 func (resp *Response) Depth() uint32 {
 	return resp.depth
 }
+
+// Session 获取响应所属的会话
+func (resp *Response) Session() string {
+	return resp.session
+}
+
+// SetSession 设置响应所属的会话
+func (resp *Response) SetSession(session string) {
+	resp.session = session
+}
+
+// Fingerprint 获取对应请求的指纹
+func (resp *Response) Fingerprint() string {
+	return resp.fingerprint
+}
+
+// SetFingerprint 设置对应请求的指纹
+func (resp *Response) SetFingerprint(fingerprint string) {
+	resp.fingerprint = fingerprint
+}
@@ -34,6 +34,10 @@ func (g *gureRegister) Register(m module.Module) (bool, error) {
 		return false, fmt.Errorf("type of module is not equal to %s", moduleType)
 	}
 	g.rwLock.Lock()
+	//第一次注册该类型时创建对应的map
+	if g.moduleTypeMap[moduleType] == nil {
+		g.moduleTypeMap[moduleType] = map[module.MID]module.Module{}
+	}
 	g.moduleTypeMap[moduleType][mid] = m
 	g.rwLock.Unlock()
 	return true, nil
@@ -0,0 +1,157 @@
+package robots
+
+import (
+	"Gure/gerror"
+	"Gure/module"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRobotsSize robots.txt最多解析的字节数
+	maxRobotsSize = 512 * 1024
+	// failureTTL 下载失败时结果的缓存时间，到期后重新下载，避免一次偶然的失败长时间禁止访问整个站点
+	failureTTL = time.Minute
+)
+
+// FetchFunc 下载robots.txt的方法，一般由调度器通过注册的下载器提供
+type FetchFunc func(req *module.Request) (*module.Response, error)
+
+// Robots robots.txt的获取、缓存与检查，要求并发安全
+type Robots interface {
+	// UserAgent 遵守规则时使用的用户代理
+	UserAgent() string
+	// Rules 返回链接所在主机的规则，缓存失效时重新下载
+	// 下载失败时返回禁止访问的规则以及错误，失败的结果只缓存较短的时间
+	Rules(u *url.URL) (*Rules, error)
+	// Allowed 判断链接是否允许访问
+	Allowed(u *url.URL) (bool, error)
+}
+
+// entry 单个主机的缓存
+type entry struct {
+	rules  *Rules
+	expire time.Time
+	//下载完成后关闭，避免同一主机重复下载
+	done chan struct{}
+}
+
+type gureRobots struct {
+	//用户代理
+	userAgent string
+	//缓存时间
+	ttl time.Duration
+	//下载方法
+	fetch FetchFunc
+	//缓存锁
+	lock sync.Mutex
+	//主机到缓存的映射，键为 scheme://host
+	entries map[string]*entry
+}
+
+func (g *gureRobots) UserAgent() string {
+	return g.userAgent
+}
+
+func (g *gureRobots) Rules(u *url.URL) (*Rules, error) {
+	if u == nil {
+		return nil, gerror.NewIllegalParameterError("nil url")
+	}
+	key := strings.ToLower(u.Scheme + "://" + u.Host)
+	g.lock.Lock()
+	if e, ok := g.entries[key]; ok {
+		select {
+		case <-e.done:
+			if time.Now().Before(e.expire) {
+				g.lock.Unlock()
+				return e.rules, nil
+			}
+		default:
+			//其他协程正在下载，等待其完成
+			g.lock.Unlock()
+			<-e.done
+			return e.rules, nil
+		}
+	}
+	e := &entry{done: make(chan struct{})}
+	g.entries[key] = e
+	g.lock.Unlock()
+
+	rules, err := g.download(key)
+	e.rules = rules
+	ttl := g.ttl
+	if err != nil && failureTTL < ttl {
+		ttl = failureTTL
+	}
+	e.expire = time.Now().Add(ttl)
+	close(e.done)
+	return rules, err
+}
+
+func (g *gureRobots) Allowed(u *url.URL) (bool, error) {
+	rules, err := g.Rules(u)
+	if rules == nil {
+		return false, err
+	}
+	return rules.AllowedURL(u), err
+}
+
+// download 下载并解析robots.txt
+// 4xx表示没有限制，5xx以及网络错误视为禁止访问整个站点
+func (g *gureRobots) download(base string) (*Rules, error) {
+	httpReq, err := http.NewRequest(http.MethodGet, base+"/robots.txt", nil)
+	if err != nil {
+		return DisallowAll(), err
+	}
+	httpReq.Header.Set("User-Agent", g.userAgent)
+	resp, err := g.fetch(module.NewRequest(httpReq, 0))
+	if err != nil {
+		return DisallowAll(), fmt.Errorf("fetch robots.txt of %s fail with %v", base, err)
+	}
+	if resp == nil || resp.HTTPResp() == nil {
+		return DisallowAll(), fmt.Errorf("fetch robots.txt of %s with nil response", base)
+	}
+	httpResp := resp.HTTPResp()
+	if httpResp.Body != nil {
+		defer httpResp.Body.Close()
+	}
+	switch {
+	case httpResp.StatusCode >= 200 && httpResp.StatusCode < 300:
+		if httpResp.Body == nil {
+			return AllowAll(), nil
+		}
+		rules, err := Parse(io.LimitReader(httpResp.Body, maxRobotsSize), g.userAgent)
+		if err != nil {
+			return AllowAll(), fmt.Errorf("parse robots.txt of %s fail with %v", base, err)
+		}
+		return rules, nil
+	case httpResp.StatusCode >= 400 && httpResp.StatusCode < 500:
+		return AllowAll(), nil
+	default:
+		return DisallowAll(), fmt.Errorf("fetch robots.txt of %s with status %d", base, httpResp.StatusCode)
+	}
+}
+
+// New 创建robots.txt检查器，ttl为规则的缓存时间
+func New(userAgent string, ttl time.Duration, fetch FetchFunc) (Robots, error) {
+	if userAgent == "" {
+		return nil, gerror.NewIllegalParameterError("empty user agent")
+	}
+	if ttl <= 0 {
+		return nil, gerror.NewIllegalParameterError("invalid robots cache ttl")
+	}
+	if fetch == nil {
+		return nil, gerror.NewIllegalParameterError("nil fetch func")
+	}
+	return &gureRobots{
+		userAgent: userAgent,
+		ttl:       ttl,
+		fetch:     fetch,
+		entries:   map[string]*entry{},
+	}, nil
+}
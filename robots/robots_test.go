@@ -0,0 +1,96 @@
+package robots
+
+import (
+	"Gure/module"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const robotsTxt = `
+# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.pdf$
+
+User-agent: gurebot
+User-agent: otherbot
+Disallow: /nogure
+Crawl-delay: 2.5
+
+Sitemap: http://example.com/sitemap.xml
+`
+
+func TestParse(t *testing.T) {
+	rules, err := Parse(strings.NewReader(robotsTxt), "Mozilla/5.0 (compatible; Gurebot/1.0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules.Allowed("/nogure/a") {
+		t.Errorf("/nogure/a should be disallowed for gurebot")
+	}
+	if !rules.Allowed("/private/a") {
+		t.Errorf("gurebot group should not inherit * rules")
+	}
+	if rules.CrawlDelay() != 2500*time.Millisecond {
+		t.Errorf("crawl delay %v", rules.CrawlDelay())
+	}
+	if len(rules.Sitemaps()) != 1 || rules.Sitemaps()[0] != "http://example.com/sitemap.xml" {
+		t.Errorf("sitemaps %v", rules.Sitemaps())
+	}
+
+	rules, err = Parse(strings.NewReader(robotsTxt), "somebot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases = map[string]bool{
+		"/":                    true,
+		"/private/a":           false,
+		"/private/public.html": true,
+		"/doc/a.pdf":           false,
+		"/doc/a.pdf?x=1":       true,
+		"/robots.txt":          true,
+	}
+	for path, want := range cases {
+		if got := rules.Allowed(path); got != want {
+			t.Errorf("Allowed(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestRobots_FailureTTL(t *testing.T) {
+	var fetches int
+	fail := true
+	fetch := func(req *module.Request) (*module.Response, error) {
+		fetches++
+		if fail {
+			return nil, errors.New("connection reset")
+		}
+		httpResp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(robotsTxt))}
+		return module.NewResponse(httpResp, 0), nil
+	}
+	checker, err := New("gurebot", 24*time.Hour, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("http://example.com/page")
+	if allowed, err := checker.Allowed(u); allowed || err == nil {
+		t.Fatalf("failed fetch should disallow with error")
+	}
+	//失败的结果只缓存较短的时间，到期后重新下载
+	g := checker.(*gureRobots)
+	e := g.entries["http://example.com"]
+	if e.expire.After(time.Now().Add(failureTTL)) {
+		t.Errorf("failure cached until %v", e.expire)
+	}
+	e.expire = time.Now()
+	fail = false
+	if allowed, err := checker.Allowed(u); !allowed || err != nil || fetches != 2 {
+		t.Errorf("robots.txt should be fetched again, got %v %v after %d fetches", allowed, err, fetches)
+	}
+}
@@ -0,0 +1,215 @@
+package robots
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rule 单条Allow或Disallow规则
+type rule struct {
+	//匹配模式，支持 * 与结尾的 $
+	pattern string
+	//是否允许访问
+	allow bool
+}
+
+// group 一个或多个User-agent共享的规则组
+type group struct {
+	agents []string
+	rules  []rule
+	delay  time.Duration
+}
+
+// Rules 针对某一用户代理解析后的robots.txt规则
+type Rules struct {
+	rules    []rule
+	delay    time.Duration
+	sitemaps []string
+	//为true时禁止访问所有链接，用于robots.txt无法获取的情况
+	disallowAll bool
+}
+
+// AllowAll 返回允许访问所有链接的规则
+func AllowAll() *Rules {
+	return &Rules{}
+}
+
+// DisallowAll 返回禁止访问所有链接的规则
+func DisallowAll() *Rules {
+	return &Rules{disallowAll: true}
+}
+
+// Parse 解析robots.txt，选取与userAgent最匹配的规则组，没有匹配时使用 * 规则组
+func Parse(r io.Reader, userAgent string) (*Rules, error) {
+	var groups []*group
+	var current *group
+	var sitemaps []string
+	//上一行是否为规则，规则之后出现的User-agent表示新的规则组
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+		switch key {
+		case "user-agent":
+			if current == nil || inRules {
+				current = &group{}
+				groups = append(groups, current)
+				inRules = false
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			//空的Disallow表示不做任何限制
+			if value == "" {
+				continue
+			}
+			current.rules = append(current.rules, rule{pattern: value, allow: key == "allow"})
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			current.delay = time.Duration(seconds * float64(time.Second))
+		case "sitemap":
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	rules := &Rules{sitemaps: sitemaps}
+	for _, g := range selectGroups(groups, userAgent) {
+		rules.rules = append(rules.rules, g.rules...)
+		if g.delay > rules.delay {
+			rules.delay = g.delay
+		}
+	}
+	return rules, nil
+}
+
+// selectGroups 选取与用户代理匹配最长的规则组，同名的规则组会被合并
+func selectGroups(groups []*group, userAgent string) []*group {
+	userAgent = strings.ToLower(userAgent)
+	var selected, wildcard []*group
+	longest := 0
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				wildcard = append(wildcard, g)
+				continue
+			}
+			if agent == "" || !strings.Contains(userAgent, agent) {
+				continue
+			}
+			if len(agent) > longest {
+				longest = len(agent)
+				selected = selected[:0]
+			}
+			if len(agent) == longest {
+				selected = append(selected, g)
+			}
+		}
+	}
+	if len(selected) > 0 {
+		return selected
+	}
+	return wildcard
+}
+
+// Allowed 判断路径是否允许访问，path应包含查询参数
+// 匹配最长的规则生效，长度相同时Allow优先
+func (r *Rules) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+	allowed := true
+	longest := -1
+	for _, ru := range r.rules {
+		if !match(ru.pattern, path) {
+			continue
+		}
+		if len(ru.pattern) > longest || (len(ru.pattern) == longest && ru.allow) {
+			longest = len(ru.pattern)
+			allowed = ru.allow
+		}
+	}
+	return allowed
+}
+
+// AllowedURL 判断链接是否允许访问
+func (r *Rules) AllowedURL(u *url.URL) bool {
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return r.Allowed(path)
+}
+
+// CrawlDelay 返回Crawl-delay指定的访问间隔，未指定时为0
+func (r *Rules) CrawlDelay() time.Duration {
+	return r.delay
+}
+
+// Sitemaps 返回Sitemap指定的站点地图地址
+func (r *Rules) Sitemaps() []string {
+	return r.sitemaps
+}
+
+// match 判断路径是否匹配模式，* 匹配任意字符，结尾的 $ 表示路径结束
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	//第一段必须是前缀
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+	//中间部分贪心地取最早出现的位置
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(rest, last)
+	}
+	return strings.Contains(rest, last)
+}
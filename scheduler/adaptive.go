@@ -0,0 +1,250 @@
+package scheduler
+
+import (
+	"Gure/gerror"
+	"Gure/module"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDecreaseFactor 默认的并发上限缩减系数
+	DefaultDecreaseFactor = 0.5
+	// DefaultLatencyTolerance 默认的延迟容忍倍数
+	DefaultLatencyTolerance = 2.0
+	// DefaultErrorThreshold 默认的错误率阈值
+	DefaultErrorThreshold = 0.1
+	// adaptiveAlpha 延迟与错误率滑动平均的权重
+	adaptiveAlpha = 0.2
+	// baselineAlpha 基准延迟向更高的延迟靠拢的权重，主机的延迟持续升高后基准随之升高
+	baselineAlpha = 0.01
+	// minDecreaseInterval 两次缩减之间的最短间隔，避免同一批失败的请求连续缩减
+	minDecreaseInterval = time.Second
+)
+
+// AdaptiveConcurrency 按主机自适应调整下载并发的设置，采用加性增长、乘性缩减
+// 延迟与错误率正常时每次成功下载使上限增加 1/上限，即每轮增加1
+// 遇到429、503、超时，或者延迟、错误率超出阈值时上限乘以DecreaseFactor
+type AdaptiveConcurrency struct {
+	//MaxLimit 单个主机的并发上限，为0时不开启自适应并发，每个主机同时只下载一个请求
+	MaxLimit uint32 `json:"maxLimit,omitempty"`
+
+	//MinLimit 单个主机的并发下限，默认为1
+	MinLimit uint32 `json:"minLimit,omitempty"`
+
+	//InitialLimit 单个主机的初始并发上限，默认为MinLimit
+	InitialLimit uint32 `json:"initialLimit,omitempty"`
+
+	//DecreaseFactor 缩减时乘以的系数，范围为(0,1)
+	DecreaseFactor float64 `json:"decreaseFactor,omitempty"`
+
+	//LatencyTolerance 延迟的滑动平均超过基准延迟的该倍数时视为拥塞，基准延迟取最低延迟并且随时间缓慢升高
+	LatencyTolerance float64 `json:"latencyTolerance,omitempty"`
+
+	//ErrorThreshold 错误率的滑动平均超过该值时视为拥塞，范围为(0,1)
+	ErrorThreshold float64 `json:"errorThreshold,omitempty"`
+}
+
+func (a *AdaptiveConcurrency) Check() error {
+	if a.MaxLimit == 0 {
+		return nil
+	}
+	if a.MinLimit == 0 {
+		a.MinLimit = 1
+	}
+	if a.InitialLimit == 0 {
+		a.InitialLimit = a.MinLimit
+	}
+	if a.DecreaseFactor == 0 {
+		a.DecreaseFactor = DefaultDecreaseFactor
+	}
+	if a.LatencyTolerance == 0 {
+		a.LatencyTolerance = DefaultLatencyTolerance
+	}
+	if a.ErrorThreshold == 0 {
+		a.ErrorThreshold = DefaultErrorThreshold
+	}
+	if a.MinLimit > a.MaxLimit || a.InitialLimit < a.MinLimit || a.InitialLimit > a.MaxLimit {
+		return gerror.NewIllegalParameterError("invalid adaptive concurrency limits")
+	}
+	if a.DecreaseFactor <= 0 || a.DecreaseFactor >= 1 {
+		return gerror.NewIllegalParameterError("invalid adaptive concurrency DecreaseFactor")
+	}
+	if a.LatencyTolerance <= 1 {
+		return gerror.NewIllegalParameterError("invalid adaptive concurrency LatencyTolerance")
+	}
+	if a.ErrorThreshold <= 0 || a.ErrorThreshold >= 1 {
+		return gerror.NewIllegalParameterError("invalid adaptive concurrency ErrorThreshold")
+	}
+	return nil
+}
+
+// HostLimit 单个主机的并发情况
+type HostLimit struct {
+	//Limit 当前的并发上限
+	Limit uint32 `json:"limit"`
+	//Latency 下载延迟的滑动平均，单位毫秒
+	Latency int64 `json:"latency"`
+	//ErrorRate 错误率的滑动平均
+	ErrorRate float64 `json:"errorRate"`
+	//Called为开始的下载次数，Accepted为收到响应的次数，Completed为正常完成的次数，Handling为正在下载的数量
+	module.Counts
+}
+
+// outcome 单次下载的结果
+type outcome int
+
+const (
+	// outcomeSuccess 正常完成
+	outcomeSuccess outcome = iota
+	// outcomeError 普通错误，计入错误率
+	outcomeError
+	// outcomeCongestion 服务端要求降低频率或者超时，直接缩减
+	outcomeCongestion
+	// outcomeDropped 请求被下载器中间件丢弃或者直接从缓存返回，没有访问网络
+	outcomeDropped
+)
+
+// classify 判断下载结果的类型
+func classify(resp *module.Response, err error) outcome {
+	if errors.Is(err, module.ErrRequestDropped) {
+		return outcomeDropped
+	}
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+			return outcomeCongestion
+		}
+		return outcomeError
+	}
+	if resp == nil || resp.HTTPResp() == nil {
+		return outcomeError
+	}
+	if resp.FromCache() {
+		return outcomeDropped
+	}
+	switch code := resp.HTTPResp().StatusCode; {
+	case code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable:
+		return outcomeCongestion
+	case code >= 500:
+		return outcomeError
+	}
+	return outcomeSuccess
+}
+
+// hostState 单个主机的自适应状态
+type hostState struct {
+	limit   float64
+	latency float64
+	//基准延迟，低于基准时直接更新，高于基准时缓慢靠拢
+	baseline  float64
+	errorRate float64
+	//上次缩减的时间
+	decreased time.Time
+	counts    module.Counts
+}
+
+// hostLimiter 按主机记录下载结果并调整并发上限，要求并发安全
+type hostLimiter struct {
+	lock   sync.Mutex
+	args   AdaptiveConcurrency
+	states map[string]*hostState
+}
+
+func newHostLimiter(args AdaptiveConcurrency) *hostLimiter {
+	return &hostLimiter{args: args, states: map[string]*hostState{}}
+}
+
+// state 返回主机的状态，调用方需要持有锁
+func (h *hostLimiter) state(host string) *hostState {
+	s, ok := h.states[host]
+	if !ok {
+		s = &hostState{limit: float64(h.args.InitialLimit)}
+		h.states[host] = s
+	}
+	return s
+}
+
+// Start 记录主机开始一次下载
+func (h *hostLimiter) Start(host string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s := h.state(host)
+	s.counts.Called++
+	s.counts.Handling++
+}
+
+// Finish 记录主机的一次下载结果，返回调整后的并发上限
+func (h *hostLimiter) Finish(host string, resp *module.Response, err error, latency time.Duration, now time.Time) int {
+	result := classify(resp, err)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s := h.state(host)
+	if s.counts.Handling > 0 {
+		s.counts.Handling--
+	}
+	if result == outcomeDropped {
+		return int(s.limit)
+	}
+	congested := result == outcomeCongestion
+	if result == outcomeError {
+		s.errorRate += adaptiveAlpha * (1 - s.errorRate)
+	} else {
+		s.errorRate -= adaptiveAlpha * s.errorRate
+	}
+	if err == nil {
+		s.counts.Accepted++
+	}
+	if result == outcomeSuccess {
+		s.counts.Completed++
+		ms := float64(latency) / float64(time.Millisecond)
+		if s.latency == 0 {
+			s.latency = ms
+		} else {
+			s.latency += adaptiveAlpha * (ms - s.latency)
+		}
+		if s.baseline == 0 || ms < s.baseline {
+			s.baseline = ms
+		} else {
+			s.baseline += baselineAlpha * (ms - s.baseline)
+		}
+		congested = s.baseline > 0 && s.latency > s.baseline*h.args.LatencyTolerance
+	}
+	congested = congested || s.errorRate > h.args.ErrorThreshold
+	switch {
+	case congested:
+		if now.Sub(s.decreased) >= minDecreaseInterval {
+			s.limit *= h.args.DecreaseFactor
+			s.decreased = now
+		}
+	case result == outcomeSuccess:
+		s.limit += 1 / s.limit
+	}
+	if s.limit < float64(h.args.MinLimit) {
+		s.limit = float64(h.args.MinLimit)
+	}
+	if s.limit > float64(h.args.MaxLimit) {
+		s.limit = float64(h.args.MaxLimit)
+	}
+	return int(s.limit)
+}
+
+// Limits 返回所有主机的并发情况
+func (h *hostLimiter) Limits() map[string]HostLimit {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	limits := make(map[string]HostLimit, len(h.states))
+	for host, s := range h.states {
+		limits[host] = HostLimit{
+			Limit:     uint32(s.limit),
+			Latency:   int64(s.latency),
+			ErrorRate: s.errorRate,
+			Counts:    s.counts,
+		}
+	}
+	return limits
+}
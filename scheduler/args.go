@@ -2,9 +2,11 @@ package scheduler
 
 import (
 	"Gure/gerror"
+	"Gure/kits"
 	"Gure/module"
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 //Args 提供自检方法
@@ -12,14 +14,67 @@ type Args interface {
 	Check() error
 }
 
+// OrderPolicy 相同优先级请求的调度顺序
+type OrderPolicy string
+
+const (
+	// PolicyBFS 广度优先，深度小的请求先下载
+	PolicyBFS OrderPolicy = "bfs"
+	// PolicyDFS 深度优先，深度大的请求先下载
+	PolicyDFS OrderPolicy = "dfs"
+)
+
 // RequestArgs 请求参数设置
 type RequestArgs struct {
 
-	//AcceptedDomains 接受的请求域
+	//AcceptedDomains 接受的请求域，匹配时忽略端口，以 *. 开头表示该域名及其所有子域名
 	AcceptedDomains []string `json:"acceptedDomains,omitempty"`
 
+	//MatchRegistrableDomain 接受与AcceptedDomains属于同一可注册域名的主机，例如 www.example.co.uk 与 shop.example.co.uk
+	MatchRegistrableDomain bool `json:"matchRegistrableDomain,omitempty"`
+
+	//PublicSuffixFile publicsuffix.org 格式的公共后缀列表文件，开启MatchRegistrableDomain时必须设置
+	//完整的列表可以从 https://publicsuffix.org/list/public_suffix_list.dat 下载
+	PublicSuffixFile string `json:"publicSuffixFile,omitempty"`
+
+	//IncludePatterns 链接的包含规则，不为空时规范化后的链接需要匹配其中之一
+	IncludePatterns []string `json:"includePatterns,omitempty"`
+
+	//ExcludePatterns 链接的排除规则，规范化后的链接匹配其中之一时被丢弃
+	ExcludePatterns []string `json:"excludePatterns,omitempty"`
+
 	//MaxDepth 最大的请求深度，不允许超过该深度
 	MaxDepth uint32 `json:"maxDepth,omitempty"`
+
+	//MinHostDelay 同一主机两次请求之间的最小间隔，单位毫秒
+	MinHostDelay uint32 `json:"minHostDelay,omitempty"`
+
+	//HostDelays 为特定主机单独设置的最小间隔，单位毫秒，覆盖MinHostDelay，键为主机名，默认端口可以省略
+	HostDelays map[string]uint32 `json:"hostDelays,omitempty"`
+
+	//Policy 相同优先级请求的调度顺序，默认为广度优先
+	Policy OrderPolicy `json:"policy,omitempty"`
+
+	//Canonical 链接规范化规则，规范化后的链接用于去重与域名检查
+	Canonical kits.CanonicalRules `json:"canonical,omitempty"`
+
+	//FingerprintHeaders 参与请求指纹计算的请求头，指纹相同的请求只会被下载一次
+	FingerprintHeaders []string `json:"fingerprintHeaders,omitempty"`
+
+	//Retry 下载失败时的重试策略，默认不重试
+	Retry RetryPolicy `json:"retry,omitempty"`
+
+	//Adaptive 按主机自适应调整下载并发，默认每个主机同时只下载一个请求
+	Adaptive AdaptiveConcurrency `json:"adaptive,omitempty"`
+
+	//IdleTimeout 空闲超过该时间后自动停止，单位秒，为0时不自动停止
+	IdleTimeout uint32 `json:"idleTimeout,omitempty"`
+
+	//RobotsUserAgent 遵守robots.txt时使用的用户代理，为空则不检查robots.txt
+	RobotsUserAgent string `json:"robotsUserAgent,omitempty"`
+
+	//RobotsCacheTTL robots.txt规则的缓存时间，单位秒
+	RobotsCacheTTL uint32 `json:"robotsCacheTTL,omitempty"`
 }
 
 func (r *RequestArgs) Check() error {
@@ -29,9 +84,50 @@ func (r *RequestArgs) Check() error {
 	if r.MaxDepth <= 1 {
 		return gerror.NewIllegalParameterError("invalid MaxDepth in reqArgs")
 	}
+	//没有内置的公共后缀列表，匹配可注册域名时需要从文件加载
+	if r.MatchRegistrableDomain && r.PublicSuffixFile == "" {
+		return gerror.NewIllegalParameterError("empty PublicSuffixFile with MatchRegistrableDomain in reqArgs")
+	}
+	if _, err := compilePatterns(r.IncludePatterns); err != nil {
+		return err
+	}
+	if _, err := compilePatterns(r.ExcludePatterns); err != nil {
+		return err
+	}
+	switch r.Policy {
+	case "":
+		r.Policy = PolicyBFS
+	case PolicyBFS, PolicyDFS:
+	default:
+		return gerror.NewIllegalParameterError("invalid Policy in reqArgs")
+	}
+	if r.Canonical.StripParams == nil {
+		r.Canonical.StripParams = kits.DefaultStripParams
+	}
+	if err := r.Retry.Check(); err != nil {
+		return err
+	}
+	if err := r.Adaptive.Check(); err != nil {
+		return err
+	}
+	if r.RobotsUserAgent != "" && r.RobotsCacheTTL == 0 {
+		r.RobotsCacheTTL = DefaultRobotsCacheTTL
+	}
 	return nil
 }
 
+// VisitedSetType 已访问集合的实现类型
+type VisitedSetType string
+
+const (
+	// VisitedMap 基于内存字典，准确但内存随链接数量增长
+	VisitedMap VisitedSetType = "map"
+	// VisitedBloom 基于可扩展布隆过滤器，内存占用小但存在误判
+	VisitedBloom VisitedSetType = "bloom"
+	// VisitedDisk 基于磁盘文件，内存占用与链接数量无关
+	VisitedDisk VisitedSetType = "disk"
+)
+
 // DataArgs 数据相关设置
 type DataArgs struct {
 	ReqBufferCap uint32 `json:"reqBufferCap,omitempty"`
@@ -49,18 +145,123 @@ type DataArgs struct {
 	ErrorBufferCap uint32 `json:"errorBufferCap,omitempty"`
 
 	ErrorBufferMaxNum uint32 `json:"errorBufferMaxCap,omitempty"`
+
+	//ReqOverflow 请求缓冲池已满时的处理策略，与其他缓冲池不同，默认溢出到磁盘，溢出文件的位置见SpillDir
+	//解析出的请求又会被下载，请求与响应缓冲池同时阻塞时下载与解析会互相等待，因此不能与RespOverflow同时为阻塞
+	//不希望写入磁盘时可以设置为丢弃策略，被丢弃的请求记录到死信中，或者在RespOverflow不阻塞时设置为阻塞
+	ReqOverflow kits.OverflowPolicy `json:"reqOverflow,omitempty"`
+
+	//RespOverflow 响应缓冲池已满时的处理策略，默认阻塞，响应体无法溢出到磁盘
+	RespOverflow kits.OverflowPolicy `json:"respOverflow,omitempty"`
+
+	//ItemOverflow 条目缓冲池已满时的处理策略，默认阻塞，条目的类型经过编码后无法还原，不能溢出到磁盘
+	ItemOverflow kits.OverflowPolicy `json:"itemOverflow,omitempty"`
+
+	//ErrorOverflow 错误缓冲池已满时的处理策略，默认丢弃最早的错误，无人读取错误时不会阻塞
+	ErrorOverflow kits.OverflowPolicy `json:"errorOverflow,omitempty"`
+
+	//SpillDir 溢出文件所在目录，溢出的请求写入其中的gure-spill-*子目录，停止时删除
+	//为空时使用系统临时目录（os.TempDir），请求较多时应当设置为空间充足的目录
+	SpillDir string `json:"spillDir,omitempty"`
+
+	//QueueDir 请求队列的数据目录，设置后溢出的请求保存在其中的分段文件里，停止时缓冲池中的请求也会写入
+	//使用同一目录重新初始化后继续爬取，未设置断点目录时frontier中与正在下载的请求也会在停止时写回队列
+	QueueDir string `json:"queueDir,omitempty"`
+
+	//CheckpointDir 定期保存断点的目录，为空则不保存，文件名为 CheckpointFileName
+	CheckpointDir string `json:"checkpointDir,omitempty"`
+
+	//CheckpointInterval 定期保存断点的间隔，单位为秒
+	CheckpointInterval uint32 `json:"checkpointInterval,omitempty"`
+
+	//CookieDir 保存各个会话Cookie的目录，重新初始化后恢复之前的登录状态，为空时Cookie只保存在内存中
+	CookieDir string `json:"cookieDir,omitempty"`
+
+	//DeadLetterFile 永久失败的请求与条目以JSONL格式追加写入的文件，为空则不记录
+	DeadLetterFile string `json:"deadLetterFile,omitempty"`
+
+	//VisitedSet 已访问集合的实现类型，默认为map
+	VisitedSet VisitedSetType `json:"visitedSet,omitempty"`
+
+	//VisitedCapacity 布隆过滤器初始容量，超出后会追加新的过滤器
+	VisitedCapacity uint32 `json:"visitedCapacity,omitempty"`
+
+	//VisitedFPRate 布隆过滤器的误判率
+	VisitedFPRate float64 `json:"visitedFPRate,omitempty"`
+
+	//VisitedDir 磁盘集合的数据目录，保存断点时同时在其中保存集合的快照，恢复断点时使用对应的快照替换集合
+	//目录中已有链接时需要在启动之前恢复断点，否则启动失败，新的爬取应当使用空的目录
+	VisitedDir string `json:"visitedDir,omitempty"`
 }
 
 // Check 利用反射进行校验
 func (r *DataArgs) Check() error {
 	va := reflect.ValueOf(*r) //参数必须要是结构体
 	for i := 0; i < va.NumField(); i++ {
+		//只校验缓冲相关的参数
+		if !strings.Contains(va.Type().Field(i).Name, "Buffer") {
+			continue
+		}
 		field := va.Field(i)
 		count := field.Interface()
 		if count.(uint32) < 1 {
 			return fmt.Errorf("invalid buffer params in dataArgs")
 		}
 	}
+	//请求缓冲池默认溢出到磁盘，打破下载与解析之间的循环等待
+	if r.ReqOverflow == "" {
+		r.ReqOverflow = kits.PolicySpill
+	}
+	if r.RespOverflow == "" {
+		r.RespOverflow = kits.PolicyBlock
+	}
+	if r.ItemOverflow == "" {
+		r.ItemOverflow = kits.PolicyBlock
+	}
+	if r.ErrorOverflow == "" {
+		r.ErrorOverflow = kits.PolicyDropOldest
+	}
+	for _, policy := range []kits.OverflowPolicy{r.ReqOverflow, r.RespOverflow, r.ItemOverflow, r.ErrorOverflow} {
+		switch policy {
+		case kits.PolicyBlock, kits.PolicyDropOldest, kits.PolicyDropNewest, kits.PolicySpill:
+		default:
+			return fmt.Errorf("invalid overflow policy %q in dataArgs", policy)
+		}
+	}
+	if r.RespOverflow == kits.PolicySpill || r.ItemOverflow == kits.PolicySpill || r.ErrorOverflow == kits.PolicySpill {
+		return fmt.Errorf("response, item and error pools can not spill in dataArgs")
+	}
+	//下载协程阻塞在响应缓冲池时无法取出请求，解析协程阻塞在请求缓冲池时无法取出响应
+	if r.ReqOverflow == kits.PolicyBlock && r.RespOverflow == kits.PolicyBlock {
+		return fmt.Errorf("request and response pools can not both block in dataArgs")
+	}
+	if r.QueueDir != "" && r.ReqOverflow != kits.PolicySpill {
+		return fmt.Errorf("request queue dir requires the spill policy in dataArgs")
+	}
+	if r.CheckpointDir != "" && r.CheckpointInterval == 0 {
+		r.CheckpointInterval = DefaultCheckpointInterval
+	}
+	switch r.VisitedSet {
+	case "":
+		r.VisitedSet = VisitedMap
+	case VisitedMap:
+	case VisitedBloom:
+		if r.VisitedCapacity == 0 {
+			r.VisitedCapacity = DefaultVisitedCapacity
+		}
+		if r.VisitedFPRate == 0 {
+			r.VisitedFPRate = DefaultVisitedFPRate
+		}
+		if r.VisitedFPRate < 0 || r.VisitedFPRate >= 1 {
+			return fmt.Errorf("invalid visited false positive rate in dataArgs")
+		}
+	case VisitedDisk:
+		if r.VisitedDir == "" {
+			return fmt.Errorf("empty visited dir in dataArgs")
+		}
+	default:
+		return fmt.Errorf("invalid visited set type in dataArgs")
+	}
 	return nil
 }
 
@@ -69,6 +270,13 @@ type ModuleArgs struct {
 	DownLoaders []module.DownLoader
 	Analyzers   []module.Analyzer
 	Pipelines   []module.Pipeline
+
+	//DownloadWorkers 同时下载的协程数量，为0时与下载器数量相同
+	DownloadWorkers uint32
+	//AnalyzeWorkers 同时解析的协程数量，为0时与解析器数量相同
+	AnalyzeWorkers uint32
+	//PickWorkers 同时处理条目的协程数量，为0时与条目处理管道数量相同
+	PickWorkers uint32
 }
 
 func (r *ModuleArgs) Check() error {
@@ -82,5 +290,15 @@ func (r *ModuleArgs) Check() error {
 	if r.Pipelines == nil || len(r.Pipelines) == 0 {
 		return fmt.Errorf("invalid module params in moduleArgs")
 	}
+	//默认每个模块对应一个处理协程
+	if r.DownloadWorkers == 0 {
+		r.DownloadWorkers = uint32(len(r.DownLoaders))
+	}
+	if r.AnalyzeWorkers == 0 {
+		r.AnalyzeWorkers = uint32(len(r.Analyzers))
+	}
+	if r.PickWorkers == 0 {
+		r.PickWorkers = uint32(len(r.Pipelines))
+	}
 	return nil
 }
@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"Gure/gerror"
+	"Gure/module"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CheckpointFileName 定期保存的断点文件名
+const CheckpointFileName = "checkpoint.json"
+
+// checkpoint 断点数据，保存恢复爬取所需的全部状态
+type checkpoint struct {
+	MaxDepth        uint32                 `json:"maxDepth"`
+	AcceptedDomains []string               `json:"acceptedDomains"`
+	Visited         json.RawMessage        `json:"visited"`
+	Pending         []module.RequestRecord `json:"pending"`
+}
+
+// Checkpoint 将当前爬取状态写入w
+func (g *gureScheduler) Checkpoint(w io.Writer) error {
+	if w == nil {
+		return gerror.NewIllegalParameterError("nil writer")
+	}
+	if g.Status() == SchedStatusUninitialized {
+		return fmt.Errorf("checkpoint on uninitialized scheduler")
+	}
+	cp := checkpoint{MaxDepth: g.maxDepth}
+	g.acceptedDomain.Range(func(key, value any) bool {
+		cp.AcceptedDomains = append(cp.AcceptedDomains, key.(string))
+		return true
+	})
+	var visited bytes.Buffer
+	if err := g.visited.Snapshot(&visited); err != nil {
+		return fmt.Errorf("snapshot visited set fail with %v", err)
+	}
+	cp.Visited = visited.Bytes()
+	g.pendingReq.Range(func(key, value any) bool {
+		cp.Pending = append(cp.Pending, value.(*module.Request).Record())
+		return true
+	})
+	//尚未启动时恢复的请求同样需要保存
+	for _, request := range g.checkpointReqs {
+		cp.Pending = append(cp.Pending, request.Record())
+	}
+	for _, request := range g.restoredReqs {
+		cp.Pending = append(cp.Pending, request.Record())
+	}
+	return json.NewEncoder(w).Encode(&cp)
+}
+
+// Restore 从r中读取断点并恢复爬取状态，恢复的请求会在Start时发送，多次恢复时只保留最后一次的请求
+// 启动后下载协程会读取最大深度等状态，因此只允许在启动之前恢复
+func (g *gureScheduler) Restore(r io.Reader) error {
+	if r == nil {
+		return gerror.NewIllegalParameterError("nil reader")
+	}
+	if status := g.Status(); status != StatusInitialized {
+		return fmt.Errorf("restore on scheduler with status %d", status)
+	}
+	var cp checkpoint
+	if err := json.NewDecoder(r).Decode(&cp); err != nil {
+		return fmt.Errorf("decode checkpoint fail with %v", err)
+	}
+	if cp.MaxDepth > 0 {
+		g.maxDepth = cp.MaxDepth
+	}
+	for _, domain := range cp.AcceptedDomains {
+		g.addDomain(domain)
+	}
+	if len(cp.Visited) > 0 && string(cp.Visited) != "null" {
+		if err := g.visited.Restore(bytes.NewReader(cp.Visited)); err != nil {
+			return fmt.Errorf("restore visited set fail with %v", err)
+		}
+	}
+	g.staleVisited = false
+	requests := make([]*module.Request, 0, len(cp.Pending))
+	for _, record := range cp.Pending {
+		request, err := record.Request()
+		if err != nil {
+			g.sendError(fmt.Errorf("restore request fail with %v", err), "")
+			continue
+		}
+		requests = append(requests, request)
+	}
+	g.checkpointReqs = requests
+	return nil
+}
+
+// saveCheckpoint 将断点保存至断点目录，先写入临时文件再重命名，避免写入中途退出导致文件损坏
+func (g *gureScheduler) saveCheckpoint() error {
+	if g.checkpointDir == "" {
+		return nil
+	}
+	g.checkpointLock.Lock()
+	defer g.checkpointLock.Unlock()
+	if err := os.MkdirAll(g.checkpointDir, 0755); err != nil {
+		return fmt.Errorf("create checkpoint dir fail with %v", err)
+	}
+	path := filepath.Join(g.checkpointDir, CheckpointFileName)
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create checkpoint file fail with %v", err)
+	}
+	if err = g.Checkpoint(file); err != nil {
+		file.Close()
+		return fmt.Errorf("write checkpoint fail with %v", err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("close checkpoint file fail with %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// autoCheckpoint 按照设置的间隔定期保存断点，调度器停止时退出
+func (g *gureScheduler) autoCheckpoint() {
+	if g.checkpointDir == "" || g.checkpointInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(g.checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-g.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := g.saveCheckpoint(); err != nil {
+					g.sendError(err, "")
+				}
+				if err := g.sessions.Save(); err != nil {
+					g.sendError(err, "")
+				}
+			}
+		}
+	}()
+}
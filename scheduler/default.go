@@ -5,3 +5,21 @@ const MB = 1024 * 1024
 const KB = 1024
 
 const EXTRA = 10
+
+// DefaultCheckpointInterval 默认的断点保存间隔，单位为秒
+const DefaultCheckpointInterval = 60
+
+// DefaultRetryBaseDelay 默认的第一次重试等待时间，单位为毫秒
+const DefaultRetryBaseDelay = 1000
+
+// DefaultRetryMaxDelay 默认的重试等待时间上限，单位为毫秒
+const DefaultRetryMaxDelay = 60 * 1000
+
+// DefaultVisitedCapacity 默认的布隆过滤器初始容量
+const DefaultVisitedCapacity = 1 << 20
+
+// DefaultVisitedFPRate 默认的布隆过滤器误判率
+const DefaultVisitedFPRate = 0.001
+
+// DefaultRobotsCacheTTL 默认的robots.txt缓存时间，单位为秒
+const DefaultRobotsCacheTTL = 24 * 60 * 60
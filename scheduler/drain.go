@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"Gure/gerror"
+	"Gure/logger"
+	"Gure/module"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DrainReport 优雅停止时被丢弃的数据数量
+type DrainReport struct {
+	//Requests 未下载的请求数量，包括停止期间通过检查的新请求，设置了请求队列或者断点目录时这些请求会被保存
+	Requests uint64 `json:"requests"`
+	//Responses 未解析的响应数量
+	Responses uint64 `json:"responses"`
+	//Items 未处理的条目数量
+	Items uint64 `json:"items"`
+}
+
+// isDraining 判断是否正在优雅停止
+func (g *gureScheduler) isDraining() bool {
+	return atomic.LoadInt32(&g.draining) == 1
+}
+
+func (g *gureScheduler) StopGraceful(ctx context.Context) (report DrainReport, err error) {
+	if ctx == nil {
+		return report, gerror.NewIllegalParameterError("nil context")
+	}
+	//暂停时需要恢复，否则响应与条目无法被处理
+	if g.Status() == SchedStatusPaused {
+		if err = g.Resume(); err != nil {
+			return
+		}
+	}
+	if status := g.Status(); status != SchedStatusStarted {
+		return report, gerror.StatusChangeError(fmt.Sprintf("graceful stop on scheduler with status %d", status))
+	}
+	if !atomic.CompareAndSwapInt32(&g.draining, 0, 1) {
+		return report, gerror.StatusChangeError("scheduler is already draining")
+	}
+	logger.Info("Draining scheduler...")
+	downloaded := make(chan struct{})
+	go func() {
+		g.downloadWG.Wait()
+		close(downloaded)
+	}()
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+	//正在进行的下载完成后，等待响应与条目处理完成
+drain:
+	for !g.canceled() {
+		select {
+		case <-downloaded:
+			if g.workCount(workResponse) <= 0 && g.workCount(workItem) <= 0 {
+				break drain
+			}
+		default:
+		}
+		select {
+		case <-ctx.Done():
+			break drain
+		case <-ticker.C:
+		}
+	}
+	report = DrainReport{
+		Requests:  nonNegative(g.workCount(workRequest)) + atomic.LoadUint64(&g.discardedReqs),
+		Responses: nonNegative(g.workCount(workResponse)),
+		Items:     nonNegative(g.workCount(workItem)),
+	}
+	logger.Infof("scheduler drained, discarded %d requests, %d responses and %d items",
+		report.Requests, report.Responses, report.Items)
+	//停止期间可能已经被自动停止
+	if !g.canceled() {
+		err = g.Stop()
+	}
+	return
+}
+
+// keepDrained 保存优雅停止期间接受的请求，设置了请求队列时放入队列，设置了断点目录时保存在断点中，否则丢弃
+// 放入队列的请求计入未完成的请求，其他请求计入被丢弃的请求
+func (g *gureScheduler) keepDrained(request *module.Request) bool {
+	if g.persistentQueue {
+		return g.putReq(request)
+	}
+	if g.checkpointDir != "" {
+		g.pendingReq.Store(request.Fingerprint(), request)
+	}
+	atomic.AddUint64(&g.discardedReqs, 1)
+	return false
+}
+
+func nonNegative(n int64) uint64 {
+	if n < 0 {
+		return 0
+	}
+	return uint64(n)
+}
@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"Gure/module"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// fingerprintHeaders 规范化参与指纹计算的请求头名称
+func fingerprintHeaders(headers []string) []string {
+	var result []string
+	for _, header := range headers {
+		result = append(result, http.CanonicalHeaderKey(strings.TrimSpace(header)))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// requestFingerprint 计算请求指纹，由请求方法、规范化后的链接、指定的请求头、所属会话以及请求体组成
+// 请求体会被转换为可重复读取的形式
+func requestFingerprint(request *module.Request, canonical *url.URL, headers []string) (string, error) {
+	if fingerprint := request.Fingerprint(); fingerprint != "" {
+		return fingerprint, nil
+	}
+	httpReq := request.HTTPRep()
+	body, err := request.Body()
+	if err != nil {
+		return "", fmt.Errorf("read request body fail with %v", err)
+	}
+	method := strings.ToUpper(httpReq.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\n%s\n", method, canonical)
+	for _, header := range headers {
+		fmt.Fprintf(h, "%s:%s\n", header, strings.Join(httpReq.Header.Values(header), ","))
+	}
+	//不同会话看到的页面可能不同，需要分别下载
+	if session := request.Session(); session != "" {
+		fmt.Fprintf(h, "session:%s\n", session)
+	}
+	fmt.Fprintf(h, "%d\n", len(body))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
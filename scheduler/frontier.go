@@ -0,0 +1,414 @@
+package scheduler
+
+import (
+	"Gure/module"
+	"container/heap"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// frontierPollInterval 没有可下载请求时的最长等待时间，避免错过新加入的主机
+const frontierPollInterval = 50 * time.Millisecond
+
+// queuedRequest 队列中的请求，seq为放入顺序，保证相同优先级时先进先出
+type queuedRequest struct {
+	req *module.Request
+	seq uint64
+}
+
+// requestHeap 按照调度顺序排序的请求堆
+type requestHeap struct {
+	items []queuedRequest
+	less  func(a, b queuedRequest) bool
+}
+
+func (h requestHeap) Len() int {
+	return len(h.items)
+}
+
+func (h requestHeap) Less(i, j int) bool {
+	return h.less(h.items[i], h.items[j])
+}
+
+func (h requestHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *requestHeap) Push(x any) {
+	h.items = append(h.items, x.(queuedRequest))
+}
+
+func (h *requestHeap) Pop() any {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items[n-1] = queuedRequest{}
+	h.items = h.items[:n-1]
+	return item
+}
+
+// delayedRequest 需要延迟到指定时间才能放入主机队列的请求，用于重试
+type delayedRequest struct {
+	req *module.Request
+	at  time.Time
+}
+
+// delayedHeap 按照放入时间排序的延迟请求堆
+type delayedHeap []delayedRequest
+
+func (h delayedHeap) Len() int {
+	return len(h)
+}
+
+func (h delayedHeap) Less(i, j int) bool {
+	return h[i].at.Before(h[j].at)
+}
+
+func (h delayedHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *delayedHeap) Push(x any) {
+	*h = append(*h, x.(delayedRequest))
+}
+
+func (h *delayedHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = delayedRequest{}
+	*h = old[:n-1]
+	return item
+}
+
+// hostQueue 单个主机的待爬取队列
+type hostQueue struct {
+	//主机名
+	host string
+	//待爬取请求
+	requests requestHeap
+	//下次允许访问的时间
+	next time.Time
+	//正在下载的请求数量
+	inflight int
+	//在等待堆或就绪堆中的位置，不在堆中为-1
+	index int
+}
+
+// idle 队列为空并且没有正在下载的请求
+func (q *hostQueue) idle() bool {
+	return q.requests.Len() == 0 && q.inflight == 0
+}
+
+// head 队列中最先被调度的请求
+func (q *hostQueue) head() queuedRequest {
+	return q.requests.items[0]
+}
+
+// hostHeap 主机堆，排序方式由less决定
+type hostHeap struct {
+	items []*hostQueue
+	less  func(a, b *hostQueue) bool
+}
+
+func (h hostHeap) Len() int {
+	return len(h.items)
+}
+
+func (h hostHeap) Less(i, j int) bool {
+	return h.less(h.items[i], h.items[j])
+}
+
+func (h hostHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *hostHeap) Push(x any) {
+	q := x.(*hostQueue)
+	q.index = len(h.items)
+	h.items = append(h.items, q)
+}
+
+func (h *hostHeap) Pop() any {
+	n := len(h.items)
+	q := h.items[n-1]
+	h.items[n-1] = nil
+	q.index = -1
+	h.items = h.items[:n-1]
+	return q
+}
+
+// frontier 按主机划分的待爬取请求集合
+// 有待爬取请求并且正在下载的请求数量低于并发上限的主机按照下次允许访问的时间放入等待堆，
+// 到达访问时间后移入就绪堆，就绪堆按照队首请求的优先级排序，保证优先级最高的请求最先下载
+// 空闲的主机同样放入等待堆，到达访问时间后仍然空闲则删除队列，既保留访问间隔又避免队列无限增长
+type frontier struct {
+	lock sync.Mutex
+	//主机到队列的映射
+	queues map[string]*hostQueue
+	//尚未到达访问时间的主机
+	waiting hostHeap
+	//已经到达访问时间的主机
+	ready hostHeap
+	//延迟放入的请求
+	delayed delayedHeap
+	//相同优先级请求的调度顺序
+	policy OrderPolicy
+	//默认的主机访问间隔
+	delay time.Duration
+	//为特定主机设置的访问间隔
+	delays map[string]time.Duration
+	//默认的主机并发上限
+	limit int
+	//为特定主机设置的并发上限
+	limits map[string]int
+	//请求放入的序号
+	seq uint64
+	//待爬取请求总数
+	total uint64
+}
+
+func newFrontier(policy OrderPolicy, delay time.Duration, delays map[string]time.Duration) *frontier {
+	f := &frontier{
+		queues: map[string]*hostQueue{},
+		policy: policy,
+		delay:  delay,
+		delays: map[string]time.Duration{},
+		limit:  1,
+		limits: map[string]int{},
+	}
+	f.waiting.less = func(a, b *hostQueue) bool {
+		return a.next.Before(b.next)
+	}
+	f.ready.less = func(a, b *hostQueue) bool {
+		return f.before(a.head(), b.head())
+	}
+	for host, d := range delays {
+		f.delays[canonicalHost(host, "")] = d
+	}
+	return f
+}
+
+// hostOf 获取请求对应的主机名
+func hostOf(req *module.Request) string {
+	u := req.HTTPRep().URL
+	return canonicalHost(u.Host, u.Scheme)
+}
+
+// canonicalHost 将主机转换为小写并去掉默认端口，example.com与example.com:80共用同一个队列
+// scheme为空时80和443都视为默认端口
+func canonicalHost(host, scheme string) string {
+	u := url.URL{Host: strings.ToLower(host)}
+	hostname, port := u.Hostname(), u.Port()
+	switch {
+	case port == "":
+		return hostname
+	case port == "80" && scheme != "https", port == "443" && scheme != "http":
+		return hostname
+	}
+	return net.JoinHostPort(hostname, port)
+}
+
+// before 判断请求a是否应当先于请求b下载
+// 优先级高的请求优先，优先级相同时按照策略比较深度，最后按照放入顺序
+func (f *frontier) before(a, b queuedRequest) bool {
+	if a.req.Priority() != b.req.Priority() {
+		return a.req.Priority() > b.req.Priority()
+	}
+	if a.req.Depth() != b.req.Depth() {
+		if f.policy == PolicyDFS {
+			return a.req.Depth() > b.req.Depth()
+		}
+		return a.req.Depth() < b.req.Depth()
+	}
+	return a.seq < b.seq
+}
+
+// Push 将请求放入对应主机的队列
+func (f *frontier) Push(req *module.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.total++
+	f.push(req)
+}
+
+// PushAfter 将请求延迟到at之后再放入对应主机的队列，期间不会占用下载协程
+func (f *frontier) PushAfter(req *module.Request, at time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.total++
+	heap.Push(&f.delayed, delayedRequest{req: req, at: at})
+}
+
+// push 放入请求，调用方需要持有锁
+func (f *frontier) push(req *module.Request) {
+	host := hostOf(req)
+	q, ok := f.queues[host]
+	if !ok {
+		q = &hostQueue{host: host, index: -1}
+		q.requests.less = f.before
+		f.queues[host] = q
+	}
+	heap.Push(&q.requests, queuedRequest{req: req, seq: f.seq})
+	f.seq++
+	if q.inflight >= f.limitOf(host) {
+		return
+	}
+	if q.index < 0 {
+		heap.Push(&f.waiting, q)
+	} else if f.inReady(q) {
+		//队首请求可能发生变化，需要重新调整位置
+		heap.Fix(&f.ready, q.index)
+	}
+}
+
+// Pop 取出一个已经到达访问时间并且优先级最高的请求，主机正在下载的请求达到并发上限后，在调用Done之前不会再被调度
+// 没有可下载的请求时返回需要等待的时间，队列为空时等待时间为0
+func (f *frontier) Pop(now time.Time) (*module.Request, time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for f.delayed.Len() > 0 && !f.delayed[0].at.After(now) {
+		f.push(heap.Pop(&f.delayed).(delayedRequest).req)
+	}
+	for f.waiting.Len() > 0 && !f.waiting.items[0].next.After(now) {
+		q := heap.Pop(&f.waiting).(*hostQueue)
+		if q.idle() {
+			delete(f.queues, q.host)
+			continue
+		}
+		heap.Push(&f.ready, q)
+	}
+	if f.ready.Len() == 0 {
+		var wait time.Duration
+		if f.waiting.Len() > 0 && f.total > 0 {
+			wait = f.waiting.items[0].next.Sub(now)
+		}
+		if f.delayed.Len() > 0 && (wait == 0 || f.delayed[0].at.Sub(now) < wait) {
+			wait = f.delayed[0].at.Sub(now)
+		}
+		return nil, wait
+	}
+	q := heap.Pop(&f.ready).(*hostQueue)
+	item := heap.Pop(&q.requests).(queuedRequest)
+	q.inflight++
+	f.total--
+	//未达到并发上限时，间隔访问时间后可以继续调度
+	if q.inflight < f.limitOf(q.host) && q.requests.Len() > 0 {
+		if next := now.Add(f.delayOf(q.host)); next.After(q.next) {
+			q.next = next
+		}
+		heap.Push(&f.waiting, q)
+	}
+	return item.req, 0
+}
+
+// Done 主机的请求下载完成，记录下次允许访问的时间并重新参与调度
+func (f *frontier) Done(host string, now time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	q, ok := f.queues[host]
+	if !ok {
+		return
+	}
+	if q.inflight > 0 {
+		q.inflight--
+	}
+	//下次访问时间可能已经被Backoff推迟
+	if next := now.Add(f.delayOf(host)); next.After(q.next) {
+		q.next = next
+	}
+	f.schedule(q)
+}
+
+// schedule 主机有待爬取请求并且未达到并发上限时放入等待堆，调用方需要持有锁
+// 空闲的主机同样放入等待堆，到达访问时间后由Pop删除
+func (f *frontier) schedule(q *hostQueue) {
+	if q.index >= 0 || q.inflight >= f.limitOf(q.host) {
+		return
+	}
+	if q.requests.Len() > 0 || q.inflight == 0 {
+		heap.Push(&f.waiting, q)
+	}
+}
+
+// SetDefaultLimit 设置主机默认的并发上限
+func (f *frontier) SetDefaultLimit(limit int) {
+	if limit < 1 {
+		limit = 1
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.limit = limit
+}
+
+// SetLimit 设置特定主机的并发上限，上限提高时主机可能重新参与调度
+func (f *frontier) SetLimit(host string, limit int) {
+	if limit < 1 {
+		limit = 1
+	}
+	host = strings.ToLower(host)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.limits[host] = limit
+	if q, ok := f.queues[host]; ok {
+		f.schedule(q)
+	}
+}
+
+// Backoff 将主机的下次访问时间推迟到until，用于服务端要求降低访问频率的情况
+func (f *frontier) Backoff(host string, until time.Time) {
+	host = strings.ToLower(host)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	q, ok := f.queues[host]
+	if !ok || !until.After(q.next) {
+		return
+	}
+	q.next = until
+	if f.inReady(q) {
+		heap.Remove(&f.ready, q.index)
+		heap.Push(&f.waiting, q)
+	} else if q.index >= 0 {
+		heap.Fix(&f.waiting, q.index)
+	}
+}
+
+// RaiseDelay 提高特定主机的访问间隔，低于当前间隔时不做修改
+func (f *frontier) RaiseDelay(host string, delay time.Duration) {
+	host = strings.ToLower(host)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if delay > f.delayOf(host) {
+		f.delays[host] = delay
+	}
+}
+
+// Len 待爬取请求总数
+func (f *frontier) Len() uint64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.total
+}
+
+// inReady 判断主机是否位于就绪堆中
+func (f *frontier) inReady(q *hostQueue) bool {
+	return q.index >= 0 && q.index < f.ready.Len() && f.ready.items[q.index] == q
+}
+
+func (f *frontier) limitOf(host string) int {
+	if limit, ok := f.limits[host]; ok {
+		return limit
+	}
+	return f.limit
+}
+
+func (f *frontier) delayOf(host string) time.Duration {
+	if d, ok := f.delays[host]; ok {
+		return d
+	}
+	return f.delay
+}
@@ -1,17 +1,24 @@
 package scheduler
 
 import (
+	"Gure/deadletter"
 	"Gure/gerror"
 	"Gure/kits"
 	"Gure/logger"
 	"Gure/module"
 	"Gure/regist"
+	"Gure/robots"
+	"Gure/seed"
+	"Gure/session"
 	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"regexp"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type gureMap struct {
@@ -21,23 +28,105 @@ type gureMap struct {
 //scheduler 结构体
 
 type gureScheduler struct {
+	//尚未处理完成的请求、响应与条目数量，放在首位保证原子操作的对齐
+	working [workKinds]int64
+	//各阶段正在处理数据的协程数量，下标与working相同
+	busy [workKinds]int64
+	//各阶段的处理协程数量，下标与working相同
+	workers [workKinds]uint32
+	//按主机调整下载并发，为空时不开启自适应并发
+	limiter *hostLimiter
+	//空闲超过该时间后自动停止，为0时不自动停止
+	idleTimeout time.Duration
+	//优雅停止期间被拒绝的新请求数量
+	discardedReqs uint64
+	//是否正在优雅停止，为1时不再接受与下载新的请求
+	draining int32
+	//正在后台读取的种子来源数量，读取完成之前不会空闲
+	seeding int32
+	//下载协程的退出等待
+	downloadWG sync.WaitGroup
+	//解析协程的退出等待
+	analyzeWG sync.WaitGroup
 	//最大访问深度
 	maxDepth uint32
 	//可接受的域名范围
 	acceptedDomain gureMap
+	//可接受的可注册域名，开启可注册域名匹配时使用
+	registrableDomain gureMap
+	//公共后缀列表，为空时不进行可注册域名匹配
+	suffixList *kits.SuffixList
+	//链接的包含与排除规则
+	includeURL []*regexp.Regexp
+	excludeURL []*regexp.Regexp
+	//链接规范化规则
+	canonical kits.CanonicalRules
+	//参与请求指纹计算的请求头
+	fingerprintHeaders []string
 	//组件注册器
 	registrar module.Registrar
 
-	reqBuffPool kits.Pool
+	reqBuffPool kits.Pool[*module.Request]
 
-	respBuffPool kits.Pool
+	//按主机划分的待爬取请求，请求从reqBuffPool中取出后放入
+	frontier *frontier
 
-	itemBuffPool kits.Pool
+	//frontier中最多容纳的请求数量，超出部分留在reqBuffPool中
+	frontierCap uint64
 
-	errBuffPool kits.Pool
+	//下载失败时的重试策略
+	retryPolicy RetryPolicy
 
-	//完成的链接
-	urlMap gureMap
+	respBuffPool kits.Pool[*module.Response]
+
+	itemBuffPool kits.Pool[module.Item]
+
+	errBuffPool kits.Pool[error]
+
+	//已经接受的链接，放入缓冲池时添加，用于去重
+	visited kits.VisitedSet
+
+	//磁盘集合中有之前爬取留下的链接，恢复断点之前不能启动
+	staleVisited bool
+
+	//robots.txt检查器，为nil时不检查
+	robots robots.Robots
+
+	//robots.txt中发现的站点地图
+	sitemaps gureMap
+
+	//已放入缓冲池但尚未下载完成的请求，请求队列持久化时只包括已经从缓冲池中取出的请求
+	pendingReq gureMap
+
+	//请求缓冲池是否保存在数据目录中
+	persistentQueue bool
+
+	//从断点恢复、等待启动后发送的请求，再次恢复时被替换
+	checkpointReqs []*module.Request
+
+	//从死信恢复、等待启动后发送的请求
+	restoredReqs []*module.Request
+
+	//从死信恢复、等待启动后发送的条目
+	restoredItems []module.Item
+
+	//死信存储，为nil时不记录
+	deadLetters deadletter.Store
+
+	//本次爬取的Cookie存储
+	sessions session.Store
+
+	//启动时在种子之前执行的登录请求
+	logins []session.Login
+
+	//断点保存目录
+	checkpointDir string
+
+	//断点保存间隔
+	checkpointInterval time.Duration
+
+	//断点锁，避免同时写入
+	checkpointLock sync.Mutex
 
 	//用于停止调度器
 	ctx context.Context
@@ -51,6 +140,12 @@ type gureScheduler struct {
 	//状态锁
 	statusLock sync.RWMutex
 
+	//暂停时不为nil，恢复时关闭以唤醒各个处理循环
+	resumeCh chan struct{}
+
+	//暂停锁，保护resumeCh
+	pauseLock sync.Mutex
+
 	//摘要
 	summary SchedulerSummary
 }
@@ -91,7 +186,18 @@ func (g *gureScheduler) Init(reqArgs RequestArgs, dataArgs DataArgs, moduleArgs
 	//三个都校验完成，开始初始化操作
 	//初始化链接保存map
 	g.acceptedDomain = gureMap{}
-	g.urlMap = gureMap{}
+	g.registrableDomain = gureMap{}
+	for kind := range g.working {
+		atomic.StoreInt64(&g.working[kind], 0)
+	}
+	atomic.StoreUint64(&g.discardedReqs, 0)
+	atomic.StoreInt32(&g.draining, 0)
+	g.pendingReq = gureMap{}
+	g.sitemaps = gureMap{}
+	g.checkpointReqs = nil
+	g.restoredReqs = nil
+	g.restoredItems = nil
+	g.logins = nil
 
 	//初始化取消上下文
 	ctx, cancelFunc := context.WithCancel(context.Background())
@@ -100,11 +206,22 @@ func (g *gureScheduler) Init(reqArgs RequestArgs, dataArgs DataArgs, moduleArgs
 	//初始化注册器
 	g.registrar = regist.NewRegister()
 
-	err = g.register(moduleArgs)
-	err = fmt.Errorf("register module fail with %v", err)
+	if err = g.register(moduleArgs); err != nil {
+		return fmt.Errorf("register module fail with %v", err)
+	}
+	g.workers[workRequest] = moduleArgs.DownloadWorkers
+	g.workers[workResponse] = moduleArgs.AnalyzeWorkers
+	g.workers[workItem] = moduleArgs.PickWorkers
 
-	g.setReqArgs(reqArgs)
-	g.setDataArgs(dataArgs)
+	if err = g.setReqArgs(reqArgs); err != nil {
+		return err
+	}
+	if err = g.setDataArgs(dataArgs); err != nil {
+		return err
+	}
+	if err = g.attachSessions(); err != nil {
+		return err
+	}
 	//注册
 	g.summary = &SummaryStruct{
 		RequestArgs: reqArgs,
@@ -112,11 +229,18 @@ func (g *gureScheduler) Init(reqArgs RequestArgs, dataArgs DataArgs, moduleArgs
 		ModuleArgs:  moduleArgs,
 	}
 
-	//完成之后生成最后的摘要结构体,可能会出现注册失败场景
-	return err
+	return nil
+}
+
+func (g *gureScheduler) Start(firstReq *http.Request) error {
+	var seeds []*http.Request
+	if firstReq != nil {
+		seeds = append(seeds, firstReq)
+	}
+	return g.StartWithSeeds(seeds)
 }
 
-func (g *gureScheduler) Start(firstReq *http.Request) (err error) {
+func (g *gureScheduler) StartWithSeeds(seeds []*http.Request, sources ...seed.Source) (err error) {
 	//捕获panic防止程序崩溃
 	defer func() {
 		if p := recover(); p != nil {
@@ -144,33 +268,117 @@ func (g *gureScheduler) Start(firstReq *http.Request) (err error) {
 	if err != nil {
 		return
 	}
-	//检查传入的初始参数
-	if firstReq == nil {
-		err = gerror.NewIllegalParameterError("nil firstReq")
+	//暂停状态应当使用Resume恢复
+	if oldStatus == SchedStatusPaused {
+		err = gerror.StatusChangeError("scheduler is paused, use resume")
 		return
 	}
-	//获得初次的域名并进行添加
-	var primaryDomain string
-	if firstReq.Host == "" {
-		err = gerror.NewIllegalParameterError("empty host")
+	//之前爬取留下的链接会让种子被当作已访问，需要恢复断点或者使用空的目录
+	if g.staleVisited {
+		err = gerror.NewIllegalParameterError("non-empty VisitedDir without restoring a checkpoint")
+		return
+	}
+	//直接提供的种子需要全部有效，种子来源在启动之后读取
+	var firstReqs []*http.Request
+	if err = seed.FromRequests(seeds...).Seeds(func(req *http.Request) error {
+		if !validSeed(req) {
+			return gerror.NewIllegalParameterError("empty host")
+		}
+		firstReqs = append(firstReqs, req)
+		return nil
+	}); err != nil {
+		return
+	}
+	var feeds []seed.Source
+	for _, source := range sources {
+		if source != nil {
+			feeds = append(feeds, source)
+		}
+	}
+	//检查传入的初始参数，从断点恢复时允许不提供初始请求
+	if len(firstReqs) == 0 && len(feeds) == 0 && len(g.checkpointReqs) == 0 && len(g.restoredReqs) == 0 {
+		err = gerror.NewIllegalParameterError("no seed request")
 		return
 	}
-	primaryDomain = firstReq.Host
-	g.acceptedDomain.Store(primaryDomain, struct{}{})
 	//开始执行各个操作，还需要检查缓冲池的初始化问题
 	if err = g.checkPoolsForStart(); err != nil {
 		return err
 	}
+	//登录之后再开始下载，种子请求才能带上登录状态
+	if err = g.login(); err != nil {
+		return err
+	}
 	//都没有问题就可以开始爬取工作
 	//三个异步方法，同步爬取
 	g.download()
 	g.analyze()
 	g.pick()
-	request := module.NewRequest(firstReq, 0)
-	g.sendReq(request) //向缓冲池放入第一个请求
+	g.autoCheckpoint()
+	g.autoStop()
+	for _, req := range firstReqs {
+		g.sendSeed(req) //向缓冲池放入种子请求
+	}
+	g.feedSources(feeds)
+	//发送断点与死信中恢复的请求和条目
+	for _, request := range g.checkpointReqs {
+		g.putReq(request)
+	}
+	for _, request := range g.restoredReqs {
+		g.putReq(request)
+	}
+	for _, item := range g.restoredItems {
+		g.sendData(item)
+	}
+	g.checkpointReqs = nil
+	g.restoredReqs = nil
+	g.restoredItems = nil
 	return nil
 }
 
+// validSeed 判断种子请求是否有效
+func validSeed(req *http.Request) bool {
+	return req.URL != nil && req.URL.Host != ""
+}
+
+// sendSeed 发送种子请求，种子的域名是可接受的域名，会话取自请求的上下文
+func (g *gureScheduler) sendSeed(req *http.Request) bool {
+	g.addDomain(g.canonical.Canonicalize(req.URL).Host)
+	request := module.NewRequest(req, 0)
+	request.SetSession(session.SlotOf(req))
+	return g.sendReq(request)
+}
+
+// feedSources 在后台依次读取种子来源并发送种子，无效的种子与读取错误都会被报告
+//读取完成之前调度器不会被视为空闲，调度器停止时不再继续读取
+func (g *gureScheduler) feedSources(sources []seed.Source) {
+	if len(sources) == 0 {
+		return
+	}
+	atomic.AddInt32(&g.seeding, 1)
+	go func() {
+		defer atomic.AddInt32(&g.seeding, -1)
+		for _, source := range sources {
+			err := source.Seeds(func(req *http.Request) error {
+				if g.canceled() {
+					return g.ctx.Err()
+				}
+				if !validSeed(req) {
+					g.sendError(gerror.NewIllegalParameterError("empty host in seed"), "")
+					return nil
+				}
+				g.sendSeed(req)
+				return nil
+			})
+			if g.canceled() {
+				return
+			}
+			if err != nil {
+				g.sendError(fmt.Errorf("read seeds fail with %v", err), "")
+			}
+		}
+	}()
+}
+
 func (g *gureScheduler) Stop() (err error) {
 	//捕获panic防止程序崩溃
 	defer func() {
@@ -201,14 +409,95 @@ func (g *gureScheduler) Stop() (err error) {
 	}
 	//调用ctx，调用close,应当先取消，避免新请求被处理
 	g.cancelFunc()
+	//等待正在进行的下载与解析结束，断点中才包含它们产生的请求
+	g.downloadWG.Wait()
+	g.analyzeWG.Wait()
+	//关闭缓冲池之前保存最后一次断点
+	if err := g.saveCheckpoint(); err != nil {
+		logger.Warn(err.Error())
+	}
+	//没有断点时将已经取出的请求写回持久化的请求队列
+	if g.persistentQueue && g.checkpointDir == "" {
+		g.requeuePending()
+	}
 	g.reqBuffPool.Close()
 	g.respBuffPool.Close()
 	g.itemBuffPool.Close()
 	g.errBuffPool.Close()
+	if g.deadLetters != nil {
+		if err := g.deadLetters.Close(); err != nil {
+			logger.Warn(err.Error())
+		}
+	}
+	if err := g.visited.Close(); err != nil {
+		logger.Warn(err.Error())
+	}
+	if err := g.sessions.Save(); err != nil {
+		logger.Warn(err.Error())
+	}
 	logger.Info("finish close scheduler")
 	return
 }
 
+func (g *gureScheduler) Pause() (err error) {
+	logger.Info("Pausing scheduler...")
+
+	var oldStatus Status
+	oldStatus, err = g.checkAndSetStatus(SchedStatusPausing)
+	defer func() {
+		g.statusLock.Lock()
+		if err != nil {
+			g.status = oldStatus
+		} else {
+			g.status = SchedStatusPaused
+		}
+		g.statusLock.Unlock()
+	}()
+	if err != nil {
+		return
+	}
+	//各个处理循环会阻塞在resumeCh上，缓冲池中的数据保持不变
+	g.pauseLock.Lock()
+	if g.resumeCh == nil {
+		g.resumeCh = make(chan struct{})
+	}
+	g.pauseLock.Unlock()
+	logger.Info("finish pause scheduler")
+	return
+}
+
+func (g *gureScheduler) Resume() (err error) {
+	logger.Info("Resuming scheduler...")
+
+	var oldStatus Status
+	oldStatus, err = g.checkAndSetStatus(SchedStatusStarting)
+	defer func() {
+		g.statusLock.Lock()
+		if err != nil {
+			g.status = oldStatus
+		} else {
+			g.status = SchedStatusStarted
+		}
+		g.statusLock.Unlock()
+	}()
+	if err != nil {
+		return
+	}
+	if oldStatus != SchedStatusPaused {
+		err = gerror.StatusChangeError("scheduler is not paused")
+		return
+	}
+	//关闭通道唤醒所有阻塞的处理循环
+	g.pauseLock.Lock()
+	if g.resumeCh != nil {
+		close(g.resumeCh)
+		g.resumeCh = nil
+	}
+	g.pauseLock.Unlock()
+	logger.Info("finish resume scheduler")
+	return
+}
+
 func (g *gureScheduler) Status() Status {
 	g.statusLock.RLock()
 	defer g.statusLock.RUnlock()
@@ -222,30 +511,27 @@ func (g *gureScheduler) ErrorChan() (<-chan error, error) {
 		return nil, fmt.Errorf("the errBufferPool is nil")
 	}
 	errCh := make(chan error, errBuffer.BufferCap())
-	go func(errBuffer kits.Pool, errCh chan error) {
+	go func(errBuffer kits.Pool[error], errCh chan error) {
 		for {
 			if g.canceled() {
 				close(errCh) //关闭通道，外界不应该主动关闭
 				return
 			}
-			data, err := errBuffer.Get()
-			if err != nil {
+			err, getErr := errBuffer.Get(g.ctx)
+			if getErr != nil {
 				//表示连接池关闭
 				logger.Warn("errBufferPool is closed")
 				close(errCh)
 				return
 			}
-			err, ok := data.(error)
-			if !ok {
-				errMsg := fmt.Sprintf("incorrect error type %T", err)
-				logger.Warn(errMsg)
-				g.sendError(errors.New(errMsg), "")
+			if err == nil {
+				continue
 			}
-			if g.canceled() {
+			select {
+			case errCh <- err:
+			case <-g.ctx.Done():
 				close(errCh)
 				return
-			} else {
-
 			}
 
 		}
@@ -256,12 +542,31 @@ func (g *gureScheduler) ErrorChan() (<-chan error, error) {
 }
 
 func (g *gureScheduler) Idle() bool {
+	//种子来源读取完成之前不会空闲
+	if atomic.LoadInt32(&g.seeding) > 0 {
+		return false
+	}
+	//请求、响应与条目在处理完成之前都会被计数，包括缓冲池中的数据以及正在放入缓冲池的数据
+	for kind := range g.working {
+		if g.workCount(kind) > 0 {
+			return false
+		}
+	}
+	if g.frontier != nil && g.frontier.Len() > 0 {
+		return false
+	}
+	if g.reqBuffPool != nil && g.reqBuffPool.Len() > 0 ||
+		g.respBuffPool != nil && g.respBuffPool.Len() > 0 ||
+		g.itemBuffPool != nil && g.itemBuffPool.Len() > 0 {
+		return false
+	}
 	//观察是否空闲，遍历所有模块
-	var idle bool
+	if g.registrar == nil {
+		return true
+	}
 	for _, m := range g.registrar.GetAll() {
 		if m.HandlingNumber() > 0 {
-			idle = false
-			return idle
+			return false
 		}
 	}
 	return true
@@ -290,14 +595,40 @@ func (g *gureScheduler) Summary() SchedulerSummary {
 		summaryStruct.Pipelines = append(summaryStruct.Pipelines, convertToSummary(m))
 	}
 
+	if g.deadLetters != nil {
+		summaryStruct.DeadLetters = g.deadLetters.Count()
+	}
+	summaryStruct.NumUrl = g.visited.Len()
+
+	summaryStruct.Workers = WorkerSummary{
+		Download: g.stageSummary(workRequest),
+		Analyze:  g.stageSummary(workResponse),
+		Pick:     g.stageSummary(workItem),
+	}
+
+	if g.limiter != nil {
+		summaryStruct.HostLimits = g.limiter.Limits()
+	}
+
+	summaryStruct.Pools = PoolsSummary{
+		Request:  poolSummary(g.reqBuffPool),
+		Response: poolSummary(g.respBuffPool),
+		Item:     poolSummary(g.itemBuffPool),
+		Error:    poolSummary(g.errBuffPool),
+	}
+
+	summaryStruct.Sitemaps = []string{}
+	g.sitemaps.Range(func(key, value any) bool {
+		summaryStruct.Sitemaps = append(summaryStruct.Sitemaps, key.(string))
+		return true
+	})
+
 	return summaryStruct
 }
 
 func convertToSummary(m module.Module) module.SummaryStruct {
 	var summaryStruct module.SummaryStruct
 	summaryStruct.ID = m.ID()
-	summaryStruct.Completed = m.CompletedCount()
-	summaryStruct.Handling = m.HandlingNumber()
-	summaryStruct.Called = m.CalledCount()
+	summaryStruct.Counts = m.Counts()
 	return summaryStruct
 }
@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"Gure/gerror"
+	"Gure/logger"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// idlePollInterval 检查空闲状态的间隔
+const idlePollInterval = 50 * time.Millisecond
+
+// 计数的数据种类
+const (
+	workRequest = iota
+	workResponse
+	workItem
+	workKinds
+)
+
+// workStart 记录一个新的请求、响应或者条目，必须在放入缓冲池之前调用
+func (g *gureScheduler) workStart(kind int) {
+	atomic.AddInt64(&g.working[kind], 1)
+}
+
+// workDone 记录一个请求、响应或者条目处理完成，处理过程中产生的新数据已经被计数
+func (g *gureScheduler) workDone(kind int) {
+	atomic.AddInt64(&g.working[kind], -1)
+}
+
+// workCount 返回某种数据尚未处理完成的数量
+func (g *gureScheduler) workCount(kind int) int64 {
+	return atomic.LoadInt64(&g.working[kind])
+}
+
+// busyStart 记录某个阶段的协程开始处理数据
+func (g *gureScheduler) busyStart(kind int) {
+	atomic.AddInt64(&g.busy[kind], 1)
+}
+
+// busyDone 记录某个阶段的协程处理完成
+func (g *gureScheduler) busyDone(kind int) {
+	atomic.AddInt64(&g.busy[kind], -1)
+}
+
+// stageSummary 返回某个阶段的并发情况
+func (g *gureScheduler) stageSummary(kind int) StageSummary {
+	return StageSummary{
+		Workers: g.workers[kind],
+		Busy:    uint32(nonNegative(atomic.LoadInt64(&g.busy[kind]))),
+	}
+}
+
+func (g *gureScheduler) Wait(ctx context.Context) error {
+	if ctx == nil {
+		return gerror.NewIllegalParameterError("nil context")
+	}
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+	for {
+		switch status := g.Status(); status {
+		case SchedStatusStopped:
+			return nil
+		case SchedStatusUninitialized, StatusInitialized:
+			return fmt.Errorf("wait on scheduler with status %d", status)
+		case SchedStatusStarted:
+			if g.Idle() {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// autoStop 空闲持续超过idleTimeout后停止调度器
+func (g *gureScheduler) autoStop() {
+	if g.idleTimeout <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(idlePollInterval)
+		defer ticker.Stop()
+		var idleSince time.Time
+		for {
+			select {
+			case <-g.ctx.Done():
+				return
+			case now := <-ticker.C:
+				if g.Status() != SchedStatusStarted || !g.Idle() {
+					idleSince = time.Time{}
+					continue
+				}
+				if idleSince.IsZero() {
+					idleSince = now
+				}
+				if now.Sub(idleSince) < g.idleTimeout {
+					continue
+				}
+				logger.Infof("scheduler idle for %s, stopping", g.idleTimeout)
+				if err := g.Stop(); err != nil {
+					logger.Warn(err.Error())
+				}
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"Gure/gerror"
+	"Gure/kits"
+	"Gure/logger"
+	"Gure/module"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// requestCodec 请求溢出到磁盘时的编码方式，保存为请求记录的JSON
+type requestCodec struct{}
+
+func (requestCodec) Encode(request *module.Request) ([]byte, error) {
+	return json.Marshal(request.Record())
+}
+
+func (requestCodec) Decode(b []byte) (*module.Request, error) {
+	var record module.RequestRecord
+	if err := json.Unmarshal(b, &record); err != nil {
+		return nil, err
+	}
+	return record.Request()
+}
+
+// requeuePending 将已经取出但尚未下载完成的请求写回请求缓冲池，用于停止时保存到持久化的请求队列
+func (g *gureScheduler) requeuePending() {
+	g.pendingReq.Range(func(key, value any) bool {
+		if err := g.reqBuffPool.Put(context.Background(), value.(*module.Request)); err != nil {
+			logger.Warn(fmt.Sprintf("requeue pending request fail with %v", err))
+			return false
+		}
+		return true
+	})
+}
+
+// dropRequest 请求因为缓冲池已满被丢弃，记录到死信中
+func (g *gureScheduler) dropRequest(request *module.Request) {
+	g.workDone(workRequest)
+	g.pendingReq.Delete(request.Fingerprint())
+	g.deadLetterRequest(request, gerror.NewSpiderError(module.SchedulerError, "request pool is full"))
+}
+
+// dropResponse 响应因为缓冲池已满被丢弃，需要关闭响应体
+func (g *gureScheduler) dropResponse(resp *module.Response) {
+	g.workDone(workResponse)
+	g.pendingReq.Delete(resp.Fingerprint())
+	if resp.HTTPResp() != nil && resp.HTTPResp().Body != nil {
+		resp.HTTPResp().Body.Close()
+	}
+}
+
+// dropItem 条目因为缓冲池已满被丢弃，记录到死信中
+func (g *gureScheduler) dropItem(item module.Item) {
+	g.workDone(workItem)
+	g.deadLetterItem(item, gerror.NewSpiderError(module.SchedulerError, "item pool is full"))
+}
+
+// lostData 溢出的数据无法从磁盘还原，减少计数并报告错误
+func (g *gureScheduler) lostData(kind int, name string) func(n uint64, err error) {
+	return func(n uint64, err error) {
+		for i := uint64(0); i < n; i++ {
+			g.workDone(kind)
+		}
+		g.sendError(fmt.Errorf("lost %d spilled %s: %v", n, name, err), "")
+	}
+}
+
+// poolStopped 判断从缓冲池取数据的错误是否需要退出处理循环
+//只有缓冲池关闭或者调度器停止时退出，其他错误报告后稍等再继续
+func (g *gureScheduler) poolStopped(err error, name string) bool {
+	if errors.Is(err, kits.BufferClosedError) || g.ctx.Err() != nil {
+		logger.Warn(name + " pool is closed")
+		return true
+	}
+	g.sendError(fmt.Errorf("get from %s pool fail with %v", name, err), "")
+	select {
+	case <-g.ctx.Done():
+	case <-time.After(frontierPollInterval):
+	}
+	return false
+}
+
+// poolSummary 获取缓冲池的摘要
+func poolSummary[T any](pool kits.Pool[T]) PoolSummary {
+	if pool == nil {
+		return PoolSummary{}
+	}
+	return PoolSummary{Policy: pool.Policy(), Dropped: pool.Dropped(), PoolStats: pool.Stats()}
+}
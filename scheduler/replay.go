@@ -0,0 +1,47 @@
+package scheduler
+
+import (
+	"Gure/deadletter"
+	"Gure/gerror"
+	"fmt"
+	"io"
+)
+
+// Replay 读取死信并重新放入其中的请求与条目
+// 请求的尝试次数会被清零，并且不再经过去重、域名与深度检查
+func (g *gureScheduler) Replay(r io.Reader) error {
+	if r == nil {
+		return gerror.NewIllegalParameterError("nil reader")
+	}
+	status := g.Status()
+	if status != StatusInitialized && status != SchedStatusStarted {
+		return fmt.Errorf("replay on scheduler with status %d", status)
+	}
+	letters, err := deadletter.Read(r)
+	if err != nil {
+		return err
+	}
+	for _, letter := range letters {
+		if letter.Request != nil {
+			request, err := letter.Request.Request()
+			if err != nil {
+				g.sendError(fmt.Errorf("replay request fail with %v", err), "")
+				continue
+			}
+			request.SetAttempt(0)
+			if status == SchedStatusStarted {
+				g.putReq(request)
+			} else {
+				g.restoredReqs = append(g.restoredReqs, request)
+			}
+		}
+		if letter.Item != nil {
+			if status == SchedStatusStarted {
+				g.sendData(letter.Item)
+			} else {
+				g.restoredItems = append(g.restoredItems, letter.Item)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"Gure/gerror"
+	"Gure/logger"
+	"Gure/module"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy 下载失败时的重试策略
+type RetryPolicy struct {
+	//MaxAttempts 最多尝试下载的次数，包含第一次，小于2表示不重试
+	MaxAttempts uint32 `json:"maxAttempts,omitempty"`
+
+	//BaseDelay 第一次重试的等待时间，之后每次翻倍，单位毫秒
+	BaseDelay uint32 `json:"baseDelay,omitempty"`
+
+	//MaxDelay 重试等待时间的上限，单位毫秒，Retry-After不受此限制
+	MaxDelay uint32 `json:"maxDelay,omitempty"`
+
+	//StatusCodes 需要重试的响应状态码
+	StatusCodes []int `json:"statusCodes,omitempty"`
+
+	//Retryable 判断下载错误是否需要重试，为nil时所有下载错误都会重试
+	Retryable func(err error) bool `json:"-"`
+}
+
+func (r *RetryPolicy) Check() error {
+	if r.MaxAttempts < 2 {
+		return nil
+	}
+	if r.BaseDelay == 0 {
+		r.BaseDelay = DefaultRetryBaseDelay
+	}
+	if r.MaxDelay == 0 {
+		r.MaxDelay = DefaultRetryMaxDelay
+	}
+	if r.MaxDelay < r.BaseDelay {
+		return gerror.NewIllegalParameterError("retry MaxDelay less than BaseDelay")
+	}
+	if r.StatusCodes == nil {
+		r.StatusCodes = []int{
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		}
+	}
+	return nil
+}
+
+// retryableErr 判断下载错误是否需要重试
+func (r *RetryPolicy) retryableErr(err error) bool {
+	if r.Retryable == nil {
+		return true
+	}
+	return r.Retryable(err)
+}
+
+// retryableStatus 判断响应状态码是否需要重试
+func (r *RetryPolicy) retryableStatus(code int) bool {
+	for _, c := range r.StatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 计算第attempt次尝试失败后的等待时间，在指数退避的基础上取后一半的随机值
+func (r *RetryPolicy) backoff(attempt uint32) time.Duration {
+	delay := time.Duration(r.BaseDelay) * time.Millisecond
+	max := time.Duration(r.MaxDelay) * time.Millisecond
+	for i := uint32(1); i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// retryAfter 解析Retry-After响应头，支持秒数与HTTP日期两种格式
+func retryAfter(httpResp *http.Response, now time.Time) time.Duration {
+	value := httpResp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// failure 判断下载结果是否失败，下载出错或者响应状态码需要重试时返回对应错误
+func (r *RetryPolicy) failure(resp *module.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if resp == nil || resp.HTTPResp() == nil {
+		return nil
+	}
+	if r.retryableStatus(resp.HTTPResp().StatusCode) {
+		return fmt.Errorf("download fail with status %s", resp.HTTPResp().Status)
+	}
+	return nil
+}
+
+// retry 根据重试策略判断失败的下载是否需要重试，需要时将请求延迟放回frontier并返回true
+// 429与503响应携带的Retry-After同时会推迟该主机的下次访问时间
+func (g *gureScheduler) retry(request *module.Request, resp *module.Response, failErr error) bool {
+	policy := &g.retryPolicy
+	if request.Attempt() >= policy.MaxAttempts {
+		return false
+	}
+	now := time.Now()
+	var wait time.Duration
+	if resp == nil || resp.HTTPResp() == nil {
+		if !policy.retryableErr(failErr) {
+			return false
+		}
+	} else {
+		httpResp := resp.HTTPResp()
+		if httpResp.StatusCode == http.StatusTooManyRequests || httpResp.StatusCode == http.StatusServiceUnavailable {
+			wait = retryAfter(httpResp, now)
+			if wait > 0 {
+				g.frontier.Backoff(hostOf(request), now.Add(wait))
+			}
+		}
+		//响应不会被解析，及时关闭
+		if httpResp.Body != nil {
+			httpResp.Body.Close()
+		}
+	}
+	if backoff := policy.backoff(request.Attempt()); backoff > wait {
+		wait = backoff
+	}
+	g.pendingReq.Store(request.Fingerprint(), request)
+	g.workStart(workRequest)
+	g.frontier.PushAfter(request, now.Add(wait))
+	logger.Warn(fmt.Sprintf("retry %s after %s with attempt %d: %s", request.HTTPRep().URL, wait, request.Attempt(), failErr))
+	return true
+}
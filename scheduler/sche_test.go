@@ -1,10 +1,60 @@
 package scheduler
 
 import (
+	"Gure/analyzer"
+	"Gure/deadletter"
+	"Gure/downloader"
+	"Gure/gerror"
+	"Gure/kits"
+	"Gure/module"
+	"Gure/pipeline"
+	"Gure/regist"
+	"Gure/seed"
+	"Gure/session"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
+// testDataArgs 每个缓冲池只有一个缓冲器的数据参数，modify用于修改其他参数，返回检查后的参数
+func testDataArgs(t *testing.T, modify ...func(args *DataArgs)) DataArgs {
+	args := DataArgs{ReqBufferCap: 1, ReqBufferMaxNum: 1, RespBufferCap: 1, RespBufferMaxNum: 1,
+		ItemBufferCap: 1, ItemBufferMaxNum: 1, ErrorBufferCap: 1, ErrorBufferMaxNum: 1}
+	for _, fn := range modify {
+		fn(&args)
+	}
+	if err := args.Check(); err != nil {
+		t.Fatal(err)
+	}
+	return args
+}
+
+// newTestScheduler 不经过Init直接设置参数的调度器，测试结束时取消上下文
+func newTestScheduler(t *testing.T, reqArgs RequestArgs, dataArgs DataArgs) *gureScheduler {
+	var g = &gureScheduler{status: StatusInitialized, registrar: regist.NewRegister()}
+	g.ctx, g.cancelFunc = context.WithCancel(context.Background())
+	t.Cleanup(g.cancelFunc)
+	if err := g.setReqArgs(reqArgs); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.setDataArgs(dataArgs); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
 func TestDataArgs_Check(t *testing.T) {
 	var d = DataArgs{
 		ReqBufferCap:      10,
@@ -18,6 +68,21 @@ func TestDataArgs_Check(t *testing.T) {
 	}
 	err := d.Check()
 	fmt.Println(err)
+	if d.ReqOverflow != kits.PolicySpill || d.ErrorOverflow != kits.PolicyDropOldest {
+		t.Fatalf("unexpected default overflow policies %q %q", d.ReqOverflow, d.ErrorOverflow)
+	}
+	d.RespOverflow = kits.PolicySpill
+	if d.Check() == nil {
+		t.Fatal("response pool should not spill")
+	}
+	d.RespOverflow, d.ItemOverflow = kits.PolicyBlock, kits.PolicySpill
+	if d.Check() == nil {
+		t.Fatal("item pool should not spill")
+	}
+	d.ItemOverflow, d.ReqOverflow = kits.PolicyBlock, kits.PolicyBlock
+	if d.Check() == nil {
+		t.Fatal("request and response pools should not both block")
+	}
 }
 
 func TestModuleArgs_Check(t *testing.T) {
@@ -25,3 +90,669 @@ func TestModuleArgs_Check(t *testing.T) {
 	err := m.Check()
 	fmt.Println(err)
 }
+
+func TestGureScheduler_Checkpoint(t *testing.T) {
+	g := newTestScheduler(t, RequestArgs{MaxDepth: 3}, testDataArgs(t))
+	g.acceptedDomain.Store("example.com", struct{}{})
+	g.visited.Add("http://example.com/")
+	httpReq, _ := http.NewRequest(http.MethodGet, "http://example.com/a", nil)
+	pending := module.NewRequest(httpReq, 1)
+	pending.SetFingerprint("a")
+	g.pendingReq.Store(pending.Fingerprint(), pending)
+	var buf bytes.Buffer
+	if err := g.Checkpoint(&buf); err != nil {
+		t.Fatal(err)
+	}
+	//启动之后不允许恢复
+	started := &gureScheduler{status: SchedStatusStarted, visited: kits.NewMapVisitedSet()}
+	if err := started.Restore(bytes.NewReader(buf.Bytes())); err == nil || started.maxDepth != 0 {
+		t.Errorf("restore after start should be rejected")
+	}
+	saved := buf.Bytes()
+	restored := newTestScheduler(t, RequestArgs{}, testDataArgs(t))
+	if err := restored.Restore(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	if restored.maxDepth != 3 {
+		t.Errorf("maxDepth %d", restored.maxDepth)
+	}
+	if ok, _ := restored.visited.Contains("http://example.com/"); !ok {
+		t.Errorf("visited url not restored")
+	}
+	if _, ok := restored.acceptedDomain.Load("example.com"); !ok {
+		t.Errorf("accepted domain not restored")
+	}
+	//再次恢复时替换之前恢复的请求
+	if err := restored.Restore(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.checkpointReqs) != 1 || restored.checkpointReqs[0].HTTPRep().URL.String() != "http://example.com/a" {
+		t.Errorf("pending request not restored %v", restored.checkpointReqs)
+	}
+}
+
+func TestGureScheduler_DiskVisited(t *testing.T) {
+	args := testDataArgs(t, func(args *DataArgs) {
+		args.VisitedSet, args.VisitedDir = VisitedDisk, t.TempDir()
+	})
+	g := newTestScheduler(t, RequestArgs{}, args)
+	g.visited.Add("checkpointed")
+	var buf bytes.Buffer
+	if err := g.Checkpoint(&buf); err != nil {
+		t.Fatal(err)
+	}
+	//断点之后添加的链接在崩溃后仍然留在数据文件中
+	g.visited.Add("after")
+	g.visited.Close()
+
+	restored := newTestScheduler(t, RequestArgs{}, args)
+	defer restored.visited.Close()
+	if !restored.staleVisited {
+		t.Errorf("non-empty visited dir should be rejected without a checkpoint")
+	}
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	ok, _ := restored.visited.Contains("checkpointed")
+	after, _ := restored.visited.Contains("after")
+	if restored.staleVisited || !ok || after {
+		t.Errorf("visited set should match the checkpoint, got checkpointed %v after %v", ok, after)
+	}
+}
+
+func TestCheckStatus_Pause(t *testing.T) {
+	if err := checkStatus(SchedStatusStarted, SchedStatusPausing); err != nil {
+		t.Errorf("started should be able to pause: %v", err)
+	}
+	if err := checkStatus(SchedStatusPaused, SchedStatusStarting); err != nil {
+		t.Errorf("paused should be able to resume: %v", err)
+	}
+	if err := checkStatus(SchedStatusPaused, SchedStatusStopping); err != nil {
+		t.Errorf("paused should be able to stop: %v", err)
+	}
+	if err := checkStatus(StatusInitialized, SchedStatusPausing); err == nil {
+		t.Errorf("initialized should not be able to pause")
+	}
+	if err := checkStatus(SchedStatusPausing, SchedStatusStopping); err == nil {
+		t.Errorf("pausing should not be able to change")
+	}
+}
+
+func TestFrontier_HostDelay(t *testing.T) {
+	f := newFrontier(PolicyBFS, time.Second, nil)
+	for _, url := range []string{"http://a.com/1", "http://a.com/2", "http://b.com/1"} {
+		httpReq, _ := http.NewRequest(http.MethodGet, url, nil)
+		f.Push(module.NewRequest(httpReq, 0))
+	}
+	now := time.Now()
+	first, _ := f.Pop(now)
+	second, _ := f.Pop(now)
+	if first == nil || second == nil || hostOf(first) == hostOf(second) {
+		t.Fatalf("expect two different hosts, got %v %v", first, second)
+	}
+	//两个主机都在下载中，不应再取出请求
+	if req, _ := f.Pop(now); req != nil {
+		t.Fatalf("busy host should not be scheduled")
+	}
+	f.Done("a.com", now)
+	if req, wait := f.Pop(now); req != nil || wait != time.Second {
+		t.Fatalf("a.com should wait a second, got %v %v", req, wait)
+	}
+	if req, _ := f.Pop(now.Add(time.Second)); req == nil || req.HTTPRep().URL.String() != "http://a.com/2" {
+		t.Fatalf("expect http://a.com/2, got %v", req)
+	}
+}
+
+func TestFrontier_Priority(t *testing.T) {
+	newReq := func(url string, depth uint32, priority int32) *module.Request {
+		httpReq, _ := http.NewRequest(http.MethodGet, url, nil)
+		req := module.NewRequest(httpReq, depth)
+		req.SetPriority(priority)
+		return req
+	}
+	var cases = []struct {
+		policy OrderPolicy
+		want   []string
+	}{
+		{PolicyBFS, []string{"http://c.com/product", "http://a.com/1", "http://b.com/2"}},
+		{PolicyDFS, []string{"http://c.com/product", "http://b.com/2", "http://a.com/1"}},
+	}
+	for _, c := range cases {
+		f := newFrontier(c.policy, 0, nil)
+		f.Push(newReq("http://a.com/1", 1, 0))
+		f.Push(newReq("http://b.com/2", 2, 0))
+		f.Push(newReq("http://c.com/product", 3, 10))
+		now := time.Now()
+		for _, want := range c.want {
+			req, _ := f.Pop(now)
+			if req == nil || req.HTTPRep().URL.String() != want {
+				t.Fatalf("%s: expect %s, got %v", c.policy, want, req)
+			}
+		}
+	}
+}
+
+func TestFrontier_PushAfter(t *testing.T) {
+	f := newFrontier(PolicyBFS, 0, nil)
+	httpReq, _ := http.NewRequest(http.MethodGet, "http://a.com/retry", nil)
+	now := time.Now()
+	f.PushAfter(module.NewRequest(httpReq, 0), now.Add(time.Second))
+	if req, wait := f.Pop(now); req != nil || wait != time.Second {
+		t.Fatalf("delayed request should wait a second, got %v %v", req, wait)
+	}
+	if req, _ := f.Pop(now.Add(time.Second)); req == nil {
+		t.Fatalf("delayed request should be ready")
+	}
+	if f.Len() != 0 {
+		t.Fatalf("frontier should be empty, got %d", f.Len())
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5}
+	if err := p.Check(); err != nil {
+		t.Fatal(err)
+	}
+	for attempt := uint32(1); attempt < 10; attempt++ {
+		d := p.backoff(attempt)
+		if d < 0 || d > time.Duration(p.MaxDelay)*time.Millisecond {
+			t.Errorf("backoff of attempt %d out of range: %v", attempt, d)
+		}
+	}
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"7"}}}
+	if d := retryAfter(resp, time.Now()); d != 7*time.Second {
+		t.Errorf("retry after %v", d)
+	}
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	var rules kits.CanonicalRules
+	newPost := func(body string) *module.Request {
+		httpReq, _ := http.NewRequest(http.MethodPost, "http://a.com/search", bytes.NewBufferString(body))
+		return module.NewRequest(httpReq, 0)
+	}
+	first, second := newPost("q=1"), newPost("q=2")
+	fp1, err := requestFingerprint(first, rules.Canonicalize(first.HTTPRep().URL), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp2, _ := requestFingerprint(second, rules.Canonicalize(second.HTTPRep().URL), nil)
+	if fp1 == fp2 {
+		t.Errorf("requests with different bodies should have different fingerprints")
+	}
+	//计算指纹后请求体仍然可读
+	if body, _ := first.Body(); string(body) != "q=1" {
+		t.Errorf("request body consumed, got %q", body)
+	}
+	second.SetFingerprint("custom")
+	if fp, _ := requestFingerprint(second, second.HTTPRep().URL, nil); fp != "custom" {
+		t.Errorf("custom fingerprint ignored, got %s", fp)
+	}
+}
+
+func TestGureScheduler_Scope(t *testing.T) {
+	args := RequestArgs{
+		AcceptedDomains:        []string{"*.example.com", "www.example.co.uk:443", "other.org"},
+		MatchRegistrableDomain: true,
+		ExcludePatterns:        []string{`\.pdf$`},
+		MaxDepth:               3,
+	}
+	//匹配可注册域名时必须提供公共后缀列表
+	if err := args.Check(); err == nil {
+		t.Errorf("empty PublicSuffixFile should be rejected")
+	}
+	args.PublicSuffixFile = filepath.Join(t.TempDir(), "public_suffix_list.dat")
+	if err := os.WriteFile(args.PublicSuffixFile, []byte("uk\nco.uk\ncom\norg\nnet\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := args.Check(); err != nil {
+		t.Fatal(err)
+	}
+	var g = &gureScheduler{}
+	if err := g.setReqArgs(args); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"http://example.com/":            true,
+		"http://a.b.example.com:8080/":   true,
+		"http://shop.example.co.uk/":     true,
+		"http://www.other.org/":          true,
+		"http://notexample.com/":         false,
+		"http://co.uk/":                  false,
+		"http://example.com/a/b.pdf":     false,
+		"http://other.example.net/index": false,
+	}
+	for link, want := range cases {
+		u, _ := url.Parse(link)
+		if got := g.inScope(g.canonical.Canonicalize(u)); got != want {
+			t.Errorf("inScope(%s) = %v, want %v", link, got, want)
+		}
+	}
+}
+
+func TestGureScheduler_Wait(t *testing.T) {
+	var g = &gureScheduler{status: SchedStatusStarted}
+	g.workStart(workResponse)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := g.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("wait should time out while working, got %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		g.workDone(workResponse)
+	}()
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Idle() {
+		t.Errorf("scheduler should be idle")
+	}
+}
+
+func TestGureScheduler_StopGraceful(t *testing.T) {
+	var g = &gureScheduler{status: SchedStatusStarted}
+	g.ctx, g.cancelFunc = context.WithCancel(context.Background())
+	defer g.cancelFunc()
+	g.workStart(workRequest)
+	g.workStart(workItem)
+	//条目处理完成之前不会停止
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if !g.isDraining() {
+			t.Errorf("scheduler should be draining")
+		}
+		g.workDone(workItem)
+		g.cancelFunc()
+	}()
+	report, err := g.StopGraceful(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requests != 1 || report.Responses != 0 || report.Items != 0 {
+		t.Errorf("unexpected drain report %+v", report)
+	}
+}
+
+func TestGureScheduler_DrainRequests(t *testing.T) {
+	g := newTestScheduler(t, RequestArgs{AcceptedDomains: []string{"example.com"}, MaxDepth: 1},
+		testDataArgs(t, func(args *DataArgs) { args.CheckpointDir = t.TempDir() }))
+	g.status, g.draining = SchedStatusStarted, 1
+	//只有通过检查的请求计入丢弃数量，并且保存在断点中
+	links := []string{"ftp://example.com/", "http://other.org/", "http://example.com/deep", "http://example.com/a", "http://example.com/a"}
+	for i, link := range links {
+		httpReq, _ := http.NewRequest(http.MethodGet, link, nil)
+		depth := uint32(0)
+		if i == 2 {
+			depth = 2
+		}
+		if g.sendReq(module.NewRequest(httpReq, depth)) {
+			t.Errorf("request %s should not be sent while draining", link)
+		}
+	}
+	if g.discardedReqs != 1 || g.reqBuffPool.Len() != 0 {
+		t.Errorf("got %d discarded requests, %d in pool", g.discardedReqs, g.reqBuffPool.Len())
+	}
+	var buf bytes.Buffer
+	if err := g.Checkpoint(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "http://example.com/a") || strings.Contains(buf.String(), "deep") {
+		t.Errorf("unexpected checkpoint %s", buf.String())
+	}
+}
+
+func TestGureScheduler_PendingUntilAnalyzed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+	parser := func(resp *http.Response, depth uint32) ([]module.Data, []error) {
+		return nil, nil
+	}
+	loader, _ := downloader.New("D|1|127.0.0.1:8080", &http.Client{}, nil)
+	ana, _ := analyzer.New("A|1|127.0.0.1:8080", []module.ParseResponse{parser}, nil)
+	g := newTestScheduler(t, RequestArgs{AcceptedDomains: []string{}, MaxDepth: 2}, testDataArgs(t))
+	g.registrar.Register(loader)
+	g.registrar.Register(ana)
+	httpReq, _ := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+	request := module.NewRequest(httpReq, 0)
+	request.SetFingerprint("page")
+	g.pendingReq.Store(request.Fingerprint(), request)
+	//下载完成后响应仍在缓冲池中，请求保留在待爬取请求里
+	g.downloadOne(request)
+	if _, ok := g.pendingReq.Load("page"); !ok {
+		t.Fatalf("request should stay pending until its response is analyzed")
+	}
+	resp, ok, err := g.respBuffPool.TryGet()
+	if err != nil || !ok {
+		t.Fatalf("response not buffered: %v", err)
+	}
+	g.analyzeOne(resp)
+	if _, ok := g.pendingReq.Load("page"); ok {
+		t.Errorf("request should not be pending after analysis")
+	}
+}
+
+// gatedSource 关闭gate之后才给出种子的来源
+type gatedSource struct {
+	gate chan struct{}
+	link string
+}
+
+func (s gatedSource) Seeds(fn func(req *http.Request) error) error {
+	<-s.gate
+	req, _ := http.NewRequest(http.MethodGet, s.link, nil)
+	return fn(req)
+}
+
+func TestGureScheduler_SeedSources(t *testing.T) {
+	g := newTestScheduler(t, RequestArgs{AcceptedDomains: []string{}, MaxDepth: 1}, testDataArgs(t))
+	//种子来源在后台读取，读取完成之前调度器不空闲
+	gate := make(chan struct{})
+	g.feedSources([]seed.Source{gatedSource{gate, "http://example.com/"}, gatedSource{gate, "/no-host"}})
+	if g.Idle() {
+		t.Errorf("scheduler should not be idle while reading seed sources")
+	}
+	close(gate)
+	for atomic.LoadInt32(&g.seeding) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if g.reqBuffPool.Len() != 1 || g.errBuffPool.Len() != 1 {
+		t.Errorf("got %d requests and %d errors", g.reqBuffPool.Len(), g.errBuffPool.Len())
+	}
+	if _, ok := g.acceptedDomain.Load("example.com"); !ok {
+		t.Errorf("seed domain should be accepted")
+	}
+}
+
+func TestGureScheduler_QueueDir(t *testing.T) {
+	args := testDataArgs(t, func(args *DataArgs) { args.QueueDir = t.TempDir() })
+	g := newTestScheduler(t, RequestArgs{}, args)
+	const n = 30
+	for i := 0; i < n; i++ {
+		httpReq, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://example.com/%d", i), nil)
+		request := module.NewRequest(httpReq, 1)
+		request.SetFingerprint(fmt.Sprint(i))
+		g.putReq(request)
+	}
+	g.reqBuffPool.Close()
+	//使用同一目录重新初始化后，缓冲池中的请求被恢复并计数
+	restored := newTestScheduler(t, RequestArgs{}, args)
+	defer restored.reqBuffPool.Close()
+	if restored.reqBuffPool.Len() != n || restored.workCount(workRequest) != n {
+		t.Fatalf("restored %d requests, counted %d", restored.reqBuffPool.Len(), restored.workCount(workRequest))
+	}
+	request, ok, err := restored.reqBuffPool.TryGet()
+	if !ok || err != nil || request.HTTPRep().URL.Path != "/0" || request.Fingerprint() != "0" {
+		t.Errorf("unexpected restored request %v %v", request, err)
+	}
+}
+
+func TestHostLimiter_AIMD(t *testing.T) {
+	args := AdaptiveConcurrency{MaxLimit: 8}
+	if err := args.Check(); err != nil {
+		t.Fatal(err)
+	}
+	h := newHostLimiter(args)
+	ok := module.NewResponse(&http.Response{StatusCode: http.StatusOK}, 0)
+	now := time.Now()
+	var limit int
+	for i := 0; i < 20; i++ {
+		h.Start("a.com")
+		limit = h.Finish("a.com", ok, nil, 100*time.Millisecond, now)
+	}
+	if limit < 4 {
+		t.Fatalf("limit should grow with healthy downloads, got %d", limit)
+	}
+	h.Start("a.com")
+	tooMany := module.NewResponse(&http.Response{StatusCode: http.StatusTooManyRequests}, 0)
+	if cut := h.Finish("a.com", tooMany, nil, 100*time.Millisecond, now.Add(time.Minute)); cut != limit/2 && cut != (limit+1)/2 {
+		t.Errorf("limit should be halved on 429, got %d from %d", cut, limit)
+	}
+	if counts := h.Limits()["a.com"].Counts; counts.Called != 21 || counts.Completed != 20 || counts.Handling != 0 {
+		t.Errorf("unexpected counts %+v", counts)
+	}
+	//缓存命中不影响延迟，延迟持续升高后基准随之升高，不再一直视为拥塞
+	hit := module.NewResponse(&http.Response{StatusCode: http.StatusOK, Header: http.Header{}}, 0)
+	hit.HTTPResp().Header.Set(module.CacheStatusHeader, module.CacheHit)
+	h.Start("a.com")
+	h.Finish("a.com", hit, nil, time.Microsecond, now)
+	if s := h.states["a.com"]; s.baseline != 100 || s.counts.Completed != 20 {
+		t.Errorf("cache hit should be ignored, got baseline %v counts %+v", s.baseline, s.counts)
+	}
+	for i := 0; i < 500; i++ {
+		h.Start("a.com")
+		h.Finish("a.com", ok, nil, time.Second, now.Add(time.Hour))
+	}
+	s := h.states["a.com"]
+	before := s.limit
+	h.Start("a.com")
+	h.Finish("a.com", ok, nil, time.Second, now.Add(2*time.Hour))
+	if s.baseline < 900 || s.limit <= before && s.limit != float64(args.MaxLimit) {
+		t.Errorf("limit should grow after baseline adapts, got baseline %v limit %v from %v", s.baseline, s.limit, before)
+	}
+}
+
+func TestFrontier_HostLimit(t *testing.T) {
+	f := newFrontier(PolicyBFS, 0, nil)
+	f.SetLimit("a.com", 2)
+	for i := 0; i < 3; i++ {
+		httpReq, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://a.com/%d", i), nil)
+		f.Push(module.NewRequest(httpReq, 0))
+	}
+	now := time.Now()
+	first, _ := f.Pop(now)
+	second, _ := f.Pop(now)
+	if first == nil || second == nil {
+		t.Fatalf("host with limit 2 should be scheduled twice")
+	}
+	if third, _ := f.Pop(now); third != nil {
+		t.Fatalf("host over limit should not be scheduled")
+	}
+	f.Done("a.com", now)
+	if third, _ := f.Pop(now); third == nil {
+		t.Fatalf("host should be scheduled after done")
+	}
+}
+
+func TestFrontier_CanonicalHost(t *testing.T) {
+	f := newFrontier(PolicyBFS, time.Second, map[string]time.Duration{"Example.com:80": time.Minute})
+	for _, rawURL := range []string{"http://example.com/a", "http://EXAMPLE.com:80/b"} {
+		httpReq, _ := http.NewRequest(http.MethodGet, rawURL, nil)
+		f.Push(module.NewRequest(httpReq, 0))
+	}
+	if len(f.queues) != 1 || f.delayOf("example.com") != time.Minute {
+		t.Fatalf("default port should share one queue, got %d queues", len(f.queues))
+	}
+	now := time.Now()
+	first, _ := f.Pop(now)
+	f.Done(hostOf(first), now)
+	second, _ := f.Pop(now.Add(time.Minute))
+	f.Done(hostOf(second), now.Add(time.Minute))
+	//空闲的队列在访问间隔之内保留，之后删除
+	if request, _ := f.Pop(now.Add(time.Minute + time.Second)); request != nil || len(f.queues) != 1 {
+		t.Fatalf("idle queue should be kept within host delay")
+	}
+	if request, _ := f.Pop(now.Add(3 * time.Minute)); request != nil || len(f.queues) != 0 {
+		t.Fatalf("idle queue should be deleted, got %d queues", len(f.queues))
+	}
+}
+
+func TestGureScheduler_Login(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			if r.FormValue("user") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: r.FormValue("user"), Path: "/"})
+			http.Redirect(w, r, "/home", http.StatusFound)
+		default:
+			if cookie, err := r.Cookie("sid"); err == nil {
+				io.WriteString(w, cookie.Value)
+			}
+		}
+	}))
+	defer server.Close()
+	loader, err := downloader.New("D|1|127.0.0.1:8080", &http.Client{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g = &gureScheduler{status: StatusInitialized, registrar: regist.NewRegister()}
+	if _, err = g.registrar.Register(loader); err != nil {
+		t.Fatal(err)
+	}
+	if g.sessions, err = session.New(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err = g.attachSessions(); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		login, _ := http.NewRequest(http.MethodPost, server.URL+"/login", strings.NewReader("user="+user))
+		login.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if err = g.AddLogin(session.Login{Slot: user, Request: login}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = g.login(); err != nil {
+		t.Fatal(err)
+	}
+	//每个会话带上各自的登录状态，默认会话没有登录
+	for _, slot := range []string{"alice", "bob", ""} {
+		httpReq, _ := http.NewRequest(http.MethodGet, server.URL+"/page", nil)
+		request := module.NewRequest(httpReq, 0)
+		request.SetSession(slot)
+		resp, err := loader.Download(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.HTTPResp().Body)
+		resp.HTTPResp().Body.Close()
+		if string(body) != slot {
+			t.Errorf("session %q got %q", slot, body)
+		}
+	}
+
+	failed, _ := http.NewRequest(http.MethodPost, server.URL+"/login", nil)
+	g.logins = []session.Login{{Slot: "eve", Request: failed}}
+	if err = g.login(); err == nil {
+		t.Errorf("unauthorized login should fail")
+	}
+}
+
+// TestGureScheduler_Crawl 完整地初始化、启动、等待与停止调度器
+//偶尔失败的请求重试后成功，下载失败的请求在重试用尽后记录为死信，条目处理管道返回的普通错误发送到错误通道
+func TestGureScheduler_Crawl(t *testing.T) {
+	var failHits, flakyHits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, "/a /fail /flaky")
+		case "/fail":
+			atomic.AddInt64(&failHits, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/flaky":
+			if atomic.AddInt64(&flakyHits, 1) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+	}))
+	defer server.Close()
+	parser := func(resp *http.Response, depth uint32) ([]module.Data, []error) {
+		body, _ := io.ReadAll(resp.Body)
+		dataList := []module.Data{module.Item{"path": resp.Request.URL.Path}}
+		for _, link := range strings.Fields(string(body)) {
+			httpReq, _ := http.NewRequest(http.MethodGet, server.URL+link, nil)
+			dataList = append(dataList, module.NewRequest(httpReq, depth+1))
+		}
+		return dataList, nil
+	}
+	var processed sync.Map
+	processor := func(item module.Item) (module.Item, error) {
+		if item["path"] == "/a" {
+			return nil, errors.New("reject /a")
+		}
+		processed.Store(item["path"], true)
+		return item, nil
+	}
+	loader, _ := downloader.New("D|1|127.0.0.1:8080", &http.Client{}, nil)
+	ana, _ := analyzer.New("A|1|127.0.0.1:8080", []module.ParseResponse{parser}, nil)
+	pipe, _ := pipeline.New("P|1|127.0.0.1:8080", nil, []module.ProcessItem{processor}, false)
+
+	deadLetterFile := filepath.Join(t.TempDir(), "dead.jsonl")
+	dataArgs := testDataArgs(t, func(args *DataArgs) { args.DeadLetterFile = deadLetterFile })
+	g := New()
+	err := g.Init(RequestArgs{AcceptedDomains: []string{}, MaxDepth: 3, Retry: RetryPolicy{MaxAttempts: 2, BaseDelay: 1, StatusCodes: []int{http.StatusInternalServerError}}},
+		dataArgs, ModuleArgs{DownLoaders: []module.DownLoader{loader}, Analyzers: []module.Analyzer{ana}, Pipelines: []module.Pipeline{pipe}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh, err := g.ErrorChan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	collected := make(chan struct{})
+	go func() {
+		for err := range errCh {
+			errs = append(errs, err)
+		}
+		close(collected)
+	}()
+	seed, _ := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+	if err = g.Start(seed); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err = g.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = g.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	<-collected
+
+	if hits := atomic.LoadInt64(&failHits); hits != 2 {
+		t.Errorf("failed request should be tried twice, got %d", hits)
+	}
+	if _, ok := processed.Load("/flaky"); !ok || atomic.LoadInt64(&flakyHits) != 2 {
+		t.Errorf("flaky request should succeed on retry, got %d hits", atomic.LoadInt64(&flakyHits))
+	}
+	var pipelineErr bool
+	for _, err := range errs {
+		if spiderErr, ok := err.(gerror.SpiderError); ok && spiderErr.Type() == module.PipelineError {
+			pipelineErr = true
+		}
+	}
+	if !pipelineErr {
+		t.Errorf("pipeline error not reported, got %v", errs)
+	}
+	file, err := os.Open(deadLetterFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	letters, err := deadletter.Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failedReq, failedItem bool
+	for _, letter := range letters {
+		if letter.Request != nil && strings.HasSuffix(letter.Request.URL, "/fail") && letter.ErrType == module.DownloaderError {
+			failedReq = true
+		}
+		if letter.Request != nil && strings.HasSuffix(letter.Request.URL, "/flaky") {
+			t.Errorf("retried request should not be dead-lettered")
+		}
+		if letter.Item != nil && letter.Item["path"] == "/a" && letter.ErrType == module.PipelineError {
+			failedItem = true
+		}
+	}
+	if !failedReq || !failedItem {
+		t.Errorf("unexpected dead letters %+v", letters)
+	}
+}
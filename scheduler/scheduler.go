@@ -1,6 +1,10 @@
 package scheduler
 
 import (
+	"Gure/seed"
+	"Gure/session"
+	"context"
+	"io"
 	"net/http"
 )
 
@@ -11,18 +15,51 @@ type Scheduler interface {
 	// Start 开始爬取第一个请求
 	Start(firstReq *http.Request) error
 
-	// Stop 暂停当前爬取工作
+	// StartWithSeeds 从多个种子请求以及种子来源开始爬取，每个种子的域名都会加入可接受的域名
+	//种子来源在启动之后于后台读取，读取出错时报告错误
+	StartWithSeeds(seeds []*http.Request, sources ...seed.Source) error
+
+	// Stop 停止当前爬取工作，等待正在进行的下载与解析结束后保存最后一次断点
 	Stop() error
 
+	// StopGraceful 停止接受与下载新的请求，等待已下载的响应与条目处理完成或者ctx结束后停止
+	// 返回被丢弃的请求、响应与条目数量
+	StopGraceful(ctx context.Context) (DrainReport, error)
+
+	// Pause 暂停当前爬取工作，保留内存中的待爬取请求
+	Pause() error
+
+	// Resume 恢复被暂停的爬取工作
+	Resume() error
+
 	// Status 返回当前状态
 	Status() Status
 
 	// ErrorChan 返回通道，接收过程中的错误
 	ErrorChan() (<-chan error, error)
 
-	// Idle 返回当前模块的空闲状态
+	// Idle 返回当前是否空闲，即没有待处理的请求、响应与条目，并且所有模块都没有在处理数据
 	Idle() bool
 
+	// Wait 阻塞直到爬取完成或者调度器停止，ctx结束时返回ctx的错误
+	Wait(ctx context.Context) error
+
 	// Summary 返回调度器摘要
 	Summary() SchedulerSummary
+
+	// Checkpoint 将待爬取请求、已访问链接、可接受域名以及最大深度写入断点
+	Checkpoint(w io.Writer) error
+
+	// Restore 从断点中恢复爬取状态，需要在初始化之后、启动之前调用
+	Restore(r io.Reader) error
+
+	// Replay 重新放入死信中的请求与条目，需要在初始化之后调用
+	Replay(r io.Reader) error
+
+	// Sessions 返回本次爬取的Cookie存储，初始化之后可以预先写入Cookie
+	//种子请求可以使用session.WithSlot指定所属的会话，解析得到的请求与发现它的页面属于同一个会话
+	Sessions() session.Store
+
+	// AddLogin 添加启动时在第一个种子之前执行的登录请求，需要在初始化之后调用
+	AddLogin(login session.Login) error
 }
@@ -1,13 +1,18 @@
 package scheduler
 
 import (
+	"Gure/deadletter"
 	"Gure/gerror"
 	"Gure/kits"
 	"Gure/logger"
 	"Gure/module"
+	"Gure/robots"
+	"Gure/session"
 	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 //提供函数支持
@@ -25,21 +30,184 @@ func (g *gureScheduler) checkAndSetStatus(wanted Status) (oldStatus Status, err
 	return
 }
 
-func (g *gureScheduler) setReqArgs(args RequestArgs) {
+func (g *gureScheduler) setReqArgs(args RequestArgs) error {
 	//传入的参数设置,默认在检查过程中完成了相应的默认值设置
+	var err error
+	g.suffixList = nil
+	if args.MatchRegistrableDomain {
+		if g.suffixList, err = loadSuffixList(args.PublicSuffixFile); err != nil {
+			return err
+		}
+	}
 	for _, domain := range args.AcceptedDomains {
-		g.acceptedDomain.Store(domain, struct{}{})
+		g.addDomain(domain)
+	}
+	if g.includeURL, err = compilePatterns(args.IncludePatterns); err != nil {
+		return err
 	}
+	if g.excludeURL, err = compilePatterns(args.ExcludePatterns); err != nil {
+		return err
+	}
+	g.canonical = args.Canonical
+	g.fingerprintHeaders = fingerprintHeaders(args.FingerprintHeaders)
 	g.maxDepth = args.MaxDepth
+	g.idleTimeout = time.Duration(args.IdleTimeout) * time.Second
+	delays := map[string]time.Duration{}
+	for host, delay := range args.HostDelays {
+		delays[host] = time.Duration(delay) * time.Millisecond
+	}
+	g.retryPolicy = args.Retry
+	g.frontier = newFrontier(args.Policy, time.Duration(args.MinHostDelay)*time.Millisecond, delays)
+	g.limiter = nil
+	if args.Adaptive.MaxLimit > 0 {
+		g.limiter = newHostLimiter(args.Adaptive)
+		g.frontier.SetDefaultLimit(int(args.Adaptive.InitialLimit))
+	}
+	g.robots = nil
+	if args.RobotsUserAgent != "" {
+		ttl := time.Duration(args.RobotsCacheTTL) * time.Second
+		checker, err := robots.New(args.RobotsUserAgent, ttl, g.fetchRobots)
+		if err != nil {
+			return err
+		}
+		g.robots = checker
+	}
+	return nil
+}
+
+// fetchRobots 通过注册的下载器下载robots.txt
+func (g *gureScheduler) fetchRobots(request *module.Request) (*module.Response, error) {
+	get, err := g.registrar.Get(module.DOWNLOADER)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get a downloader with %s", err)
+	}
+	loader, ok := get.(module.DownLoader)
+	if !ok {
+		return nil, fmt.Errorf("incorrect downloader type  %T", get)
+	}
+	return loader.Download(request)
+}
+
+// allowedByRobots 检查请求是否被robots.txt允许，同时将Crawl-delay与Sitemap提供给调度器
+func (g *gureScheduler) allowedByRobots(request *module.Request) bool {
+	if g.robots == nil {
+		return true
+	}
+	u := request.HTTPRep().URL
+	rules, err := g.robots.Rules(u)
+	if err != nil {
+		g.sendError(err, "")
+	}
+	if rules == nil {
+		return false
+	}
+	if delay := rules.CrawlDelay(); delay > 0 {
+		g.frontier.RaiseDelay(hostOf(request), delay)
+	}
+	for _, sitemap := range rules.Sitemaps() {
+		g.sitemaps.Store(sitemap, struct{}{})
+	}
+	if !rules.AllowedURL(u) {
+		errMsg := fmt.Sprintf("url %s is disallowed by robots.txt for %s", u, g.robots.UserAgent())
+		g.sendError(gerror.NewSpiderError(module.RobotsError, errMsg), "")
+		return false
+	}
+	return true
 }
 
-func (g *gureScheduler) setDataArgs(args DataArgs) {
+func (g *gureScheduler) setDataArgs(args DataArgs) error {
 	//默认此时参数都已经完成检查了，会设置阈值，少于阈值会进行修订
-	g.reqBuffPool = kits.NewPool(args.ReqBufferCap, args.ReqBufferMaxNum)
-	g.respBuffPool = kits.NewPool(args.RespBufferCap, args.RespBufferMaxNum)
-	g.itemBuffPool = kits.NewPool(args.ItemBufferCap, args.ItemBufferMaxNum)
-	g.errBuffPool = kits.NewPool(args.ErrorBufferCap, args.ErrorBufferMaxNum)
+	var err error
+	g.reqBuffPool, err = kits.NewPoolWithConfig(kits.PoolConfig[*module.Request]{
+		BufferCap:    args.ReqBufferCap,
+		MaxBufferNum: args.ReqBufferMaxNum,
+		Policy:       args.ReqOverflow,
+		SpillDir:     args.SpillDir,
+		DataDir:      args.QueueDir,
+		Codec:        requestCodec{},
+		OnDrop:       g.dropRequest,
+		OnLost:       g.lostData(workRequest, "requests"),
+	})
+	if err != nil {
+		return fmt.Errorf("create request pool fail with %v", err)
+	}
+	//数据目录中恢复的请求同样需要计数
+	g.persistentQueue = args.QueueDir != ""
+	atomic.AddInt64(&g.working[workRequest], int64(g.reqBuffPool.Len()))
+	g.respBuffPool, err = kits.NewPoolWithConfig(kits.PoolConfig[*module.Response]{
+		BufferCap:    args.RespBufferCap,
+		MaxBufferNum: args.RespBufferMaxNum,
+		Policy:       args.RespOverflow,
+		OnDrop:       g.dropResponse,
+	})
+	if err != nil {
+		return fmt.Errorf("create response pool fail with %v", err)
+	}
+	g.itemBuffPool, err = kits.NewPoolWithConfig(kits.PoolConfig[module.Item]{
+		BufferCap:    args.ItemBufferCap,
+		MaxBufferNum: args.ItemBufferMaxNum,
+		Policy:       args.ItemOverflow,
+		OnDrop:       g.dropItem,
+	})
+	if err != nil {
+		return fmt.Errorf("create item pool fail with %v", err)
+	}
+	g.errBuffPool, err = kits.NewPoolWithConfig(kits.PoolConfig[error]{
+		BufferCap:    args.ErrorBufferCap,
+		MaxBufferNum: args.ErrorBufferMaxNum,
+		Policy:       args.ErrorOverflow,
+	})
+	if err != nil {
+		return fmt.Errorf("create error pool fail with %v", err)
+	}
+	g.frontierCap = uint64(args.ReqBufferCap) * uint64(args.ReqBufferMaxNum)
+	g.checkpointDir = args.CheckpointDir
+	g.checkpointInterval = time.Duration(args.CheckpointInterval) * time.Second
+	switch args.VisitedSet {
+	case VisitedBloom:
+		g.visited, err = kits.NewBloomVisitedSet(args.VisitedCapacity, args.VisitedFPRate)
+	case VisitedDisk:
+		g.visited, err = kits.NewDiskVisitedSet(args.VisitedDir)
+	default:
+		g.visited = kits.NewMapVisitedSet()
+	}
+	if err != nil {
+		return fmt.Errorf("create visited set fail with %v", err)
+	}
+	g.staleVisited = g.visited.Len() > 0
+	g.deadLetters = nil
+	if args.DeadLetterFile != "" {
+		store, err := deadletter.NewFileStore(args.DeadLetterFile)
+		if err != nil {
+			return err
+		}
+		g.deadLetters = store
+	}
+	//每次初始化都是新的爬取，没有目录时不保留之前的Cookie
+	if g.sessions, err = session.New(args.CookieDir); err != nil {
+		return fmt.Errorf("create cookie store fail with %v", err)
+	}
+	return nil
+}
 
+// deadLetterRequest 记录永久失败的请求
+func (g *gureScheduler) deadLetterRequest(request *module.Request, err gerror.SpiderError) {
+	if g.deadLetters == nil {
+		return
+	}
+	if putErr := g.deadLetters.Put(deadletter.NewRequestLetter(request, err)); putErr != nil {
+		logger.Warn(putErr.Error())
+	}
+}
+
+// deadLetterItem 记录处理失败的条目
+func (g *gureScheduler) deadLetterItem(item module.Item, err gerror.SpiderError) {
+	if g.deadLetters == nil {
+		return
+	}
+	if putErr := g.deadLetters.Put(deadletter.NewItemLetter(item, err)); putErr != nil {
+		logger.Warn(putErr.Error())
+	}
 }
 
 func (g *gureScheduler) register(args ModuleArgs) (err error) {
@@ -65,11 +233,11 @@ func (g *gureScheduler) register(args ModuleArgs) (err error) {
 }
 
 func checkStatus(old Status, wanted Status) error {
-	//三个状态下不可以改变
-	if old == SchedStatusInitializing || old == SchedStatusStopping || old == SchedStatusStarting {
+	//四个状态下不可以改变
+	if old == SchedStatusInitializing || old == SchedStatusStopping || old == SchedStatusStarting || old == SchedStatusPausing {
 		return gerror.StatusChangeError("current status cant be changed")
 	}
-	if wanted != SchedStatusInitializing && wanted != SchedStatusStopping && wanted != SchedStatusStarting {
+	if wanted != SchedStatusInitializing && wanted != SchedStatusStopping && wanted != SchedStatusStarting && wanted != SchedStatusPausing {
 		return gerror.StatusChangeError("wanted status error")
 	}
 	if old == SchedStatusUninitialized && (wanted == SchedStatusStarting || wanted == SchedStatusStopping) {
@@ -78,7 +246,15 @@ func checkStatus(old Status, wanted Status) error {
 	if old == SchedStatusStarted && (wanted == SchedStatusStarting || wanted == SchedStatusInitializing) {
 		return gerror.StatusChangeError("cant change to wanted")
 	}
-	if old != SchedStatusStarted && wanted == SchedStatusStopping {
+	//暂停状态下可以恢复启动或者停止，但不能重新初始化
+	if old == SchedStatusPaused && wanted == SchedStatusInitializing {
+		return gerror.StatusChangeError("cant change to wanted")
+	}
+	if old != SchedStatusStarted && old != SchedStatusPaused && wanted == SchedStatusStopping {
+		return gerror.StatusChangeError("cant change to wanted")
+	}
+	//只有已启动的状态可以暂停
+	if old != SchedStatusStarted && wanted == SchedStatusPausing {
 		return gerror.StatusChangeError("cant change to wanted")
 	}
 	return nil
@@ -119,51 +295,61 @@ func (g *gureScheduler) checkPoolsForStart() error {
 
 func (g *gureScheduler) pick() {
 	//不断监听数据队列，然后交给数据处理函数去处理
-	go func() {
-		for true {
-			if g.canceled() {
-				break //跳循环结束
-			}
-			data, err := g.itemBuffPool.Get()
-			if err != nil {
-				logger.Warn("item pool is closed")
+	for i := uint32(0); i < g.workers[workItem]; i++ {
+		go g.pickLoop()
+	}
+}
+
+func (g *gureScheduler) pickLoop() {
+	for true {
+		//暂停时阻塞等待恢复，停止时退出
+		if !g.waitResume() {
+			break
+		}
+		item, err := g.itemBuffPool.Get(g.ctx)
+		if err != nil {
+			if g.poolStopped(err, "item") {
 				break
 			}
-			item, ok := data.(module.Item)
-			if !ok {
-				//数据格式有问题，向error管道发送数据
-				errMsg := fmt.Sprintf("incorrect data type %T", item)
-				g.sendError(errors.New(errMsg), "")
-			}
-			//开始执行下载操作
-			g.pickOne(item)
+			continue
 		}
-	}()
+		//开始执行下载操作
+		g.busyStart(workItem)
+		g.pickOne(item)
+		g.busyDone(workItem)
+		g.workDone(workItem)
+	}
 }
 
 func (g *gureScheduler) analyze() {
-	go func() {
-		for true {
-			if g.canceled() {
-				break //跳循环结束
-			}
-			data, err := g.respBuffPool.Get()
-			if err != nil {
-				logger.Warn("response pool is closed")
+	for i := uint32(0); i < g.workers[workResponse]; i++ {
+		g.analyzeWG.Add(1)
+		go g.analyzeLoop()
+	}
+}
+
+func (g *gureScheduler) analyzeLoop() {
+	defer g.analyzeWG.Done()
+	for true {
+		//暂停时阻塞等待恢复，停止时退出
+		if !g.waitResume() {
+			break
+		}
+		resp, err := g.respBuffPool.Get(g.ctx)
+		if err != nil {
+			if g.poolStopped(err, "response") {
 				break
 			}
-			resp, ok := data.(*module.Response)
-			if !ok {
-				//数据格式有问题，向error管道发送数据
-				errMsg := fmt.Sprintf("incorrect data type %T", resp)
-				g.sendError(errors.New(errMsg), "")
-			}
-			//开始执行下载操作
-			g.analyzeOne(resp)
+			continue
 		}
-	}()
-
+		//开始执行下载操作
+		g.busyStart(workResponse)
+		g.analyzeOne(resp)
+		g.busyDone(workResponse)
+		g.workDone(workResponse)
+	}
 }
+
 func (g *gureScheduler) pickOne(item module.Item) {
 	if item == nil {
 		return
@@ -191,6 +377,9 @@ func (g *gureScheduler) pickOne(item module.Item) {
 			g.sendError(err, ana.ID())
 		}
 	}
+	if len(errList) > 0 {
+		g.deadLetterItem(item, toSpiderError(errList[0], ana.ID()))
+	}
 }
 
 func (g *gureScheduler) analyzeOne(resp *module.Response) {
@@ -238,63 +427,166 @@ func (g *gureScheduler) analyzeOne(resp *module.Response) {
 			g.sendError(err, ana.ID())
 		}
 	}
-
+	//解析得到的请求都已经放入缓冲池，响应对应的请求不再属于待爬取请求
+	g.pendingReq.Delete(resp.Fingerprint())
 }
 
 func (g *gureScheduler) download() {
-	//开一个goroutine，不断循环读取，一旦cancel就退出就行
-	go func() {
-		for true {
-			if g.canceled() {
-				break //跳循环结束
-			}
-			data, err := g.reqBuffPool.Get()
-			if err != nil {
-				logger.Warn("request pool is closed")
-				break
+	//每个协程不断从frontier中取出到达访问时间的请求，一旦cancel就退出就行
+	for i := uint32(0); i < g.workers[workRequest]; i++ {
+		g.downloadWG.Add(1)
+		go g.downloadLoop()
+	}
+}
+
+func (g *gureScheduler) downloadLoop() {
+	defer g.downloadWG.Done()
+	for true {
+		//暂停时阻塞等待恢复，停止时退出
+		if !g.waitResume() {
+			break
+		}
+		//优雅停止时不再下载新的请求
+		if g.isDraining() {
+			break
+		}
+		//取出请求出错时frontier中已有的请求仍然可以下载
+		if err := g.fillFrontier(); err != nil && g.poolStopped(err, "request") {
+			break
+		}
+		request, wait := g.frontier.Pop(time.Now())
+		if request == nil {
+			//没有到达访问时间的主机，等待后重新检查
+			if wait <= 0 || wait > frontierPollInterval {
+				wait = frontierPollInterval
 			}
-			request, ok := data.(*module.Request)
-			if !ok {
-				//数据格式有问题，向error管道发送数据
-				errMsg := fmt.Sprintf("incorrect data type %T", request)
-				g.sendError(errors.New(errMsg), "")
+			select {
+			case <-g.ctx.Done():
+			case <-time.After(wait):
 			}
-			//开始执行下载操作
-			g.downloadOne(request)
+			continue
 		}
-	}()
+		//开始执行下载操作，需要重新下载的请求会被重新计数
+		g.busyStart(workRequest)
+		g.downloadOne(request)
+		g.busyDone(workRequest)
+		g.workDone(workRequest)
+	}
+}
+
+// fillFrontier 将请求缓冲池中的请求转移到frontier中，直到缓冲池为空或者frontier已满
+func (g *gureScheduler) fillFrontier() error {
+	for g.frontier.Len() < g.frontierCap {
+		request, ok, err := g.reqBuffPool.TryGet()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if g.persistentQueue {
+			g.pendingReq.Store(request.Fingerprint(), request)
+		}
+		g.frontier.Push(request)
+	}
+	return nil
 }
 
 func (g *gureScheduler) downloadOne(request *module.Request) {
 	if request == nil { //downloader可能是客户提供的，因此要给出判断
 		return
 	}
+	//下载结束后记录该主机下次允许访问的时间
+	defer func() {
+		g.frontier.Done(hostOf(request), time.Now())
+	}()
 	if g.canceled() {
 		return
 	}
+	if !g.allowedByRobots(request) {
+		g.pendingReq.Delete(request.Fingerprint())
+		return
+	}
 	get, err := g.registrar.Get(module.DOWNLOADER)
 	if err != nil {
 		g.sendError(fmt.Errorf("couldn't get a downloader with %s", err), "")
-		g.sendReq(request)
+		g.putReq(request)
 		return
 	}
 	loader, ok := get.(module.DownLoader)
 	if !ok {
 		g.sendError(fmt.Errorf("incorrect downloader type  %T", loader), "")
-		g.sendReq(request)
+		g.putReq(request)
 		return
 	}
+	request.SetAttempt(request.Attempt() + 1)
+	//重试时请求体需要从头读取
+	if err = request.RewindBody(); err != nil {
+		g.pendingReq.Delete(request.Fingerprint())
+		g.sendError(fmt.Errorf("rewind request body fail with %v", err), "")
+		return
+	}
+	host := hostOf(request)
+	start := time.Now()
+	if g.limiter != nil {
+		g.limiter.Start(host)
+	}
 	resp, err := loader.Download(request)
-	//这里才是真正访问过了
+	//根据下载延迟与结果调整该主机的并发上限
+	if g.limiter != nil {
+		now := time.Now()
+		g.frontier.SetLimit(host, g.limiter.Finish(host, resp, err, now.Sub(start), now))
+	}
+	//被中间件丢弃的请求不再重试
+	if errors.Is(err, module.ErrRequestDropped) {
+		g.pendingReq.Delete(request.Fingerprint())
+		return
+	}
+	//需要重试时请求会被延迟放回frontier
+	failErr := g.retryPolicy.failure(resp, err)
+	if failErr != nil && g.retry(request, resp, failErr) {
+		return
+	}
+	//重试次数用尽，记录为死信
+	if failErr != nil {
+		if err == nil {
+			if resp.HTTPResp().Body != nil {
+				resp.HTTPResp().Body.Close()
+			}
+			resp = nil
+			err = failErr
+		}
+		g.deadLetterRequest(request, toSpiderError(err, loader.ID()))
+	}
+	//这里才是真正访问过了，响应与请求属于同一个会话
+	//响应解析完成之前请求仍然属于待爬取请求，此时保存的断点不会丢失该页面的子页面
 	if resp != nil {
-		g.sendResp(resp)
+		resp.SetSession(request.Session())
+		resp.SetFingerprint(request.Fingerprint())
+		if !g.sendResp(resp) {
+			g.pendingReq.Delete(request.Fingerprint())
+		}
+	} else {
+		g.pendingReq.Delete(request.Fingerprint())
 	}
 	if err != nil {
 		g.sendError(err, loader.ID())
 	}
-	if resp != nil && err == nil {
-		g.urlMap.Store(request.HTTPRep().URL.String(), struct{}{})
+}
+
+// waitResume 暂停时阻塞直到恢复，返回false表示调度器已经停止
+func (g *gureScheduler) waitResume() bool {
+	g.pauseLock.Lock()
+	resumeCh := g.resumeCh
+	g.pauseLock.Unlock()
+	if resumeCh != nil {
+		select {
+		case <-resumeCh:
+		case <-g.ctx.Done():
+			return false
+		}
 	}
+	return !g.canceled()
 }
 
 func (g *gureScheduler) canceled() bool {
@@ -319,54 +611,94 @@ func (g *gureScheduler) sendReq(request *module.Request) bool {
 	if lower != "http" && lower != "https" {
 		return false
 	}
-	//需要检测是否有被访问过
-	var ok bool
-	_, ok = g.urlMap.Load(req.URL.String())
-	if ok {
+	//去重与域名检查都使用规范化后的链接
+	canonical := g.canonical.Canonicalize(req.URL)
+	//检查domain与链接规则,如果在原始链接的domain内
+	if !g.inScope(canonical) {
 		return false
 	}
-	//检查domain,如果在原始链接的domain内
-	_, ok = g.acceptedDomain.Load(req.URL.Host)
-	if !ok {
+	if request.Depth() > g.maxDepth {
 		return false
 	}
-	if request.Depth() > g.maxDepth {
+	//最后检查是否被接受过，放入集合后指纹相同的请求不会再被接受
+	fingerprint, err := requestFingerprint(request, canonical, g.fingerprintHeaders)
+	if err != nil {
+		g.sendError(err, "")
+		return false
+	}
+	request.SetFingerprint(fingerprint)
+	added, err := g.visited.Add(fingerprint)
+	if err != nil {
+		g.sendError(fmt.Errorf("add url to visited set fail with %v", err), "")
+		return false
+	}
+	if !added {
 		return false
 	}
-	go func(resp *module.Request) {
-		err := g.reqBuffPool.Put(request)
+	//优雅停止时不再下载新的请求
+	if g.isDraining() {
+		return g.keepDrained(request)
+	}
+	return g.putReq(request)
+}
+
+// putReq 不经过检查直接将请求放入缓冲池，用于已经被接受过的请求
+// 缓冲池已满时按照溢出策略处理，阻塞策略下会阻塞调用方
+func (g *gureScheduler) putReq(request *module.Request) bool {
+	if request == nil || g.reqBuffPool == nil || g.reqBuffPool.Closed() {
+		return false
+	}
+	//待爬取请求以指纹为键，请求溢出到磁盘后仍然可以找到
+	if request.Fingerprint() == "" {
+		fingerprint, err := requestFingerprint(request, g.canonical.Canonicalize(request.HTTPRep().URL), g.fingerprintHeaders)
 		if err != nil {
-			logger.Warn("request buffer  pool is closed")
+			g.sendError(err, "")
+			return false
 		}
-	}(request)
-
+		request.SetFingerprint(fingerprint)
+	}
+	//持久化的请求队列自行保存请求，取出后才记为待爬取请求
+	if !g.persistentQueue {
+		g.pendingReq.Store(request.Fingerprint(), request)
+	}
+	g.workStart(workRequest)
+	if err := g.reqBuffPool.Put(g.ctx, request); err != nil {
+		g.workDone(workRequest)
+		//调度器停止时保留在待爬取请求中，由最后一次断点保存
+		if !g.canceled() {
+			g.pendingReq.Delete(request.Fingerprint())
+		} else if g.persistentQueue {
+			g.pendingReq.Store(request.Fingerprint(), request)
+		}
+		logger.Warn("request buffer  pool is closed")
+		return false
+	}
 	return true
-
 }
 
 func (g *gureScheduler) sendResp(response *module.Response) bool {
 	if response == nil || g.respBuffPool == nil || g.respBuffPool.Closed() {
 		return false
 	}
-	go func(resp *module.Response) {
-		err := g.respBuffPool.Put(response)
-		if err != nil {
-			logger.Warn("response buffer  pool is closed")
-		}
-	}(response)
+	g.workStart(workResponse)
+	if err := g.respBuffPool.Put(g.ctx, response); err != nil {
+		g.workDone(workResponse)
+		logger.Warn("response buffer  pool is closed")
+		return false
+	}
 	return true
 }
 
-func (g *gureScheduler) sendData(data module.Data) bool {
+func (g *gureScheduler) sendData(data module.Item) bool {
 	if data == nil || g.itemBuffPool == nil || g.itemBuffPool.Closed() {
 		return false
 	}
-	go func(d module.Data) {
-		err := g.itemBuffPool.Put(d)
-		if err != nil {
-			logger.Warn("item buffer buffer  pool is closed")
-		}
-	}(data)
+	g.workStart(workItem)
+	if err := g.itemBuffPool.Put(g.ctx, data); err != nil {
+		g.workDone(workItem)
+		logger.Warn("item buffer buffer  pool is closed")
+		return false
+	}
 	return true
 }
 
@@ -375,6 +707,16 @@ func (g *gureScheduler) sendError(err error, mid module.MID) bool {
 	if err == nil || g.errBuffPool == nil || g.errBuffPool.Closed() {
 		return false //直接发送失败
 	}
+	spiderError := toSpiderError(err, mid)
+	if err := g.errBuffPool.Put(g.ctx, spiderError); err != nil {
+		logger.Warn("the error pool is closed when put the error")
+		return false
+	}
+	return true
+}
+
+// toSpiderError 将错误转换为框架错误
+func toSpiderError(err error, mid module.MID) gerror.SpiderError {
 	//接下来根据mid判断错误类型
 	//首先判断是不是框架错误
 	spiderError, ok := err.(gerror.SpiderError)
@@ -382,8 +724,8 @@ func (g *gureScheduler) sendError(err error, mid module.MID) bool {
 		var moduleType module.Type
 		var errType module.ErrorType
 		//根据mid解析
-		spiltMid, err := module.SpiltMid(mid)
-		if err != nil {
+		spiltMid, splitErr := module.SpiltMid(mid)
+		if splitErr != nil {
 			//解析失败，说明mid为空调度器error
 			errType = module.SchedulerError
 		} else {
@@ -400,10 +742,5 @@ func (g *gureScheduler) sendError(err error, mid module.MID) bool {
 		}
 		spiderError = gerror.NewSpiderError(errType, err.Error())
 	}
-	go func(spiderError gerror.SpiderError) {
-		if err := g.errBuffPool.Put(spiderError); err != nil {
-			logger.Warn("the error pool is closed when put the error")
-		}
-	}(spiderError)
-	return true
+	return spiderError
 }
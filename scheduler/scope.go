@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"Gure/gerror"
+	"Gure/kits"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// normalizeDomain 规范化接受的域名，转换为小写并去除端口与末尾的点
+// 以 *. 开头的域名表示该域名及其所有子域名
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	wildcard := strings.HasPrefix(domain, "*.")
+	domain = strings.TrimPrefix(domain, "*.")
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+	domain = strings.TrimSuffix(domain, ".")
+	if wildcard {
+		return "*." + domain
+	}
+	return domain
+}
+
+// compilePatterns 编译链接的正则表达式
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var result []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, gerror.NewIllegalParameterError("invalid url pattern " + pattern)
+		}
+		result = append(result, re)
+	}
+	return result, nil
+}
+
+// loadSuffixList 从文件中加载公共后缀列表
+func loadSuffixList(path string) (*kits.SuffixList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open public suffix file fail with %v", err)
+	}
+	defer file.Close()
+	list, err := kits.ParseSuffixList(file)
+	if err != nil {
+		return nil, fmt.Errorf("parse public suffix file fail with %v", err)
+	}
+	return list, nil
+}
+
+// addDomain 添加接受的域名，开启可注册域名匹配时同时记录其可注册域名
+func (g *gureScheduler) addDomain(domain string) {
+	domain = normalizeDomain(domain)
+	if domain == "" || domain == "*." {
+		return
+	}
+	g.acceptedDomain.Store(domain, struct{}{})
+	if g.suffixList == nil {
+		return
+	}
+	if registrable, err := g.suffixList.RegistrableDomain(strings.TrimPrefix(domain, "*.")); err == nil {
+		g.registrableDomain.Store(registrable, struct{}{})
+	}
+}
+
+// inScope 判断规范化后的链接是否在爬取范围内
+// 主机名需要精确匹配、命中 *. 规则或者与接受的域名属于同一可注册域名，端口不参与匹配
+// 之后链接需要匹配任意一个包含规则，且不能匹配任何排除规则
+func (g *gureScheduler) inScope(canonical *url.URL) bool {
+	host := strings.TrimSuffix(strings.ToLower(canonical.Hostname()), ".")
+	if !g.domainAccepted(host) {
+		return false
+	}
+	if len(g.includeURL) == 0 && len(g.excludeURL) == 0 {
+		return true
+	}
+	link := canonical.String()
+	for _, re := range g.excludeURL {
+		if re.MatchString(link) {
+			return false
+		}
+	}
+	if len(g.includeURL) == 0 {
+		return true
+	}
+	for _, re := range g.includeURL {
+		if re.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *gureScheduler) domainAccepted(host string) bool {
+	if host == "" {
+		return false
+	}
+	if _, ok := g.acceptedDomain.Load(host); ok {
+		return true
+	}
+	//依次检查各级父域名的 *. 规则
+	for parent := host; ; {
+		if _, ok := g.acceptedDomain.Load("*." + parent); ok {
+			return true
+		}
+		i := strings.IndexByte(parent, '.')
+		if i < 0 {
+			break
+		}
+		parent = parent[i+1:]
+	}
+	if g.suffixList == nil {
+		return false
+	}
+	registrable, err := g.suffixList.RegistrableDomain(host)
+	if err != nil {
+		return false
+	}
+	_, ok := g.registrableDomain.Load(registrable)
+	return ok
+}
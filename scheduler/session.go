@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"Gure/gerror"
+	"Gure/logger"
+	"Gure/module"
+	"Gure/session"
+	"fmt"
+	"net/http"
+)
+
+func (g *gureScheduler) Sessions() session.Store {
+	return g.sessions
+}
+
+func (g *gureScheduler) AddLogin(login session.Login) error {
+	if login.Request == nil || login.Request.URL == nil {
+		return gerror.NewIllegalParameterError("nil login request")
+	}
+	g.statusLock.RLock()
+	defer g.statusLock.RUnlock()
+	if g.status != StatusInitialized {
+		return gerror.StatusChangeError("login should be added after init and before start")
+	}
+	g.logins = append(g.logins, login)
+	return nil
+}
+
+// attachSessions 让支持会话的下载器使用本次爬取的Cookie存储
+func (g *gureScheduler) attachSessions() error {
+	loaders, err := g.registrar.GetAllByType(module.DOWNLOADER)
+	if err != nil {
+		return err
+	}
+	for mid, loader := range loaders {
+		if aware, ok := loader.(module.SessionDownloader); ok {
+			aware.SetCookieJars(g.sessions)
+			continue
+		}
+		logger.Warnf("downloader %s does not support sessions, cookies are managed by its http client", mid)
+	}
+	return nil
+}
+
+// login 在发送种子之前依次执行登录请求，任意一个失败时启动失败，成功后保存Cookie
+func (g *gureScheduler) login() error {
+	if len(g.logins) == 0 {
+		return nil
+	}
+	get, err := g.registrar.Get(module.DOWNLOADER)
+	if err != nil {
+		return fmt.Errorf("couldn't get a downloader with %s", err)
+	}
+	loader, ok := get.(module.DownLoader)
+	if !ok {
+		return fmt.Errorf("incorrect downloader type  %T", get)
+	}
+	for _, login := range g.logins {
+		request := module.NewRequest(login.Request, 0)
+		request.SetSession(login.Slot)
+		resp, err := loader.Download(request)
+		if err != nil {
+			return fmt.Errorf("login session %q fail with %v", login.Slot, err)
+		}
+		err = checkLogin(login, resp.HTTPResp())
+		if resp.HTTPResp().Body != nil {
+			resp.HTTPResp().Body.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("login session %q fail with %v", login.Slot, err)
+		}
+	}
+	return g.sessions.Save()
+}
+
+// checkLogin 检查登录响应
+func checkLogin(login session.Login, resp *http.Response) error {
+	if login.Check != nil {
+		return login.Check(resp)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
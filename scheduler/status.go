@@ -17,4 +17,8 @@ const (
 	SchedStatusStopping
 	// SchedStatusStopped 已停止的状态
 	SchedStatusStopped
+	// SchedStatusPausing 正在暂停的状态
+	SchedStatusPausing
+	// SchedStatusPaused 已暂停的状态
+	SchedStatusPaused
 )
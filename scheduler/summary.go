@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"Gure/kits"
 	"Gure/module"
 	"encoding/json"
 )
@@ -22,7 +23,45 @@ type SummaryStruct struct {
 	Downloaders []module.SummaryStruct
 	Analyzers   []module.SummaryStruct
 	Pipelines   []module.SummaryStruct
-	NumUrl      uint64
+	NumUrl      uint64 //已访问集合的大小
+	Sitemaps    []string
+	DeadLetters uint64
+	Workers     WorkerSummary        //各阶段的并发情况
+	HostLimits  map[string]HostLimit //开启自适应并发时各主机的并发上限
+	Pools       PoolsSummary         //各缓冲池的数据量与丢弃情况
+}
+
+// WorkerSummary 各阶段处理协程的摘要
+type WorkerSummary struct {
+	Download StageSummary `json:"download"`
+	Analyze  StageSummary `json:"analyze"`
+	Pick     StageSummary `json:"pick"`
+}
+
+// StageSummary 单个阶段的并发情况
+type StageSummary struct {
+	//Workers 处理协程数量
+	Workers uint32 `json:"workers"`
+	//Busy 正在处理数据的协程数量
+	Busy uint32 `json:"busy"`
+}
+
+// PoolSummary 缓冲池的摘要
+type PoolSummary struct {
+	//Policy 缓冲池已满时的处理策略
+	Policy kits.OverflowPolicy `json:"policy"`
+	//Dropped 被丢弃的数据数量
+	Dropped uint64 `json:"dropped"`
+	//数据量、容量以及等待时间等统计
+	kits.PoolStats
+}
+
+// PoolsSummary 各个缓冲池的摘要
+type PoolsSummary struct {
+	Request  PoolSummary `json:"request"`
+	Response PoolSummary `json:"response"`
+	Item     PoolSummary `json:"item"`
+	Error    PoolSummary `json:"error"`
 }
 
 // Struct 直接返回自身即可
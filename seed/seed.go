@@ -0,0 +1,96 @@
+package seed
+
+import (
+	"Gure/gerror"
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Source 种子来源，依次产生爬取的初始请求
+type Source interface {
+	// Seeds 依次将种子请求交给fn处理，fn返回错误时停止并返回该错误
+	Seeds(fn func(req *http.Request) error) error
+}
+
+// requestSource 由已有请求组成的种子来源
+type requestSource struct {
+	requests []*http.Request
+}
+
+func (s *requestSource) Seeds(fn func(req *http.Request) error) error {
+	for _, req := range s.requests {
+		if req == nil {
+			continue
+		}
+		if err := fn(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FromRequests 使用已有请求作为种子
+func FromRequests(requests ...*http.Request) Source {
+	return &requestSource{requests: requests}
+}
+
+// readerSource 从文本流中逐行读取链接的种子来源
+type readerSource struct {
+	reader io.Reader
+}
+
+func (s *readerSource) Seeds(fn func(req *http.Request) error) error {
+	return readLines(s.reader, fn)
+}
+
+// FromReader 从r中逐行读取链接，忽略空行以及以 # 开头的注释，只能读取一次
+func FromReader(r io.Reader) Source {
+	return &readerSource{reader: r}
+}
+
+// fileSource 从文本文件中逐行读取链接的种子来源
+type fileSource struct {
+	path string
+}
+
+func (s *fileSource) Seeds(fn func(req *http.Request) error) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("open seed file fail with %v", err)
+	}
+	defer file.Close()
+	return readLines(file, fn)
+}
+
+// FromFile 从文本文件中逐行读取链接，格式与FromReader相同
+func FromFile(path string) Source {
+	return &fileSource{path: path}
+}
+
+// readLines 逐行读取链接并生成GET请求
+func readLines(r io.Reader, fn func(req *http.Request) error) error {
+	if r == nil {
+		return gerror.NewIllegalParameterError("nil seed reader")
+	}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		link := strings.TrimSpace(scanner.Text())
+		if link == "" || strings.HasPrefix(link, "#") {
+			continue
+		}
+		req, err := http.NewRequest(http.MethodGet, link, nil)
+		if err != nil {
+			return fmt.Errorf("invalid seed at line %d: %v", line, err)
+		}
+		if err = fn(req); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
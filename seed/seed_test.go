@@ -0,0 +1,57 @@
+package seed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func collect(t *testing.T, source Source) []string {
+	var links []string
+	if err := source.Seeds(func(req *http.Request) error {
+		links = append(links, req.URL.String())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return links
+}
+
+func TestFromReader(t *testing.T) {
+	links := collect(t, FromReader(strings.NewReader("# categories\nhttp://a.com/1\n\n  http://b.com/2  \n")))
+	if len(links) != 2 || links[0] != "http://a.com/1" || links[1] != "http://b.com/2" {
+		t.Errorf("unexpected seeds %v", links)
+	}
+}
+
+func TestFromSitemap(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			w.Write([]byte(`<sitemapindex><sitemap><loc>` + server.URL + `/a.xml</loc></sitemap>` +
+				`<sitemap><loc>` + server.URL + `/b.xml.gz</loc></sitemap></sitemapindex>`))
+		case "/a.xml":
+			w.Write([]byte(`<urlset><url><loc>http://a.com/1</loc></url><url><loc> http://a.com/2 </loc></url></urlset>`))
+		case "/b.xml.gz":
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write([]byte(`<urlset><url><loc>http://b.com/1</loc></url></urlset>`))
+			gz.Close()
+			w.Write(buf.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	links := collect(t, FromSitemap(server.URL+"/sitemap.xml", nil))
+	if strings.Join(links, " ") != "http://a.com/1 http://a.com/2 http://b.com/1" {
+		t.Errorf("unexpected seeds %v", links)
+	}
+	if err := FromSitemap(server.URL+"/missing.xml", nil).Seeds(func(*http.Request) error { return nil }); err == nil {
+		t.Errorf("missing sitemap should fail")
+	}
+}
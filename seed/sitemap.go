@@ -0,0 +1,121 @@
+package seed
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// maxSitemapSize 单个站点地图最多读取的字节数，与sitemaps.org的限制相同
+	maxSitemapSize = 50 * 1024 * 1024
+	// maxSitemapDepth 站点地图索引最多嵌套的层数
+	maxSitemapDepth = 3
+)
+
+// FetchFunc 下载站点地图的方法
+type FetchFunc func(req *http.Request) (*http.Response, error)
+
+// sitemapDoc 同时兼容urlset与sitemapindex两种格式
+type sitemapDoc struct {
+	XMLName  xml.Name     `xml:""`
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemapSource 从站点地图中读取链接的种子来源
+type sitemapSource struct {
+	location string
+	fetch    FetchFunc
+}
+
+func (s *sitemapSource) Seeds(fn func(req *http.Request) error) error {
+	return s.walk(s.location, 0, map[string]struct{}{}, fn)
+}
+
+// walk 下载并解析站点地图，遇到站点地图索引时递归处理其中的站点地图
+func (s *sitemapSource) walk(location string, depth int, seen map[string]struct{}, fn func(req *http.Request) error) error {
+	if _, ok := seen[location]; ok {
+		return nil
+	}
+	seen[location] = struct{}{}
+	doc, err := s.download(location)
+	if err != nil {
+		return err
+	}
+	for _, u := range doc.URLs {
+		loc := strings.TrimSpace(u.Loc)
+		if loc == "" {
+			continue
+		}
+		req, err := http.NewRequest(http.MethodGet, loc, nil)
+		if err != nil {
+			return fmt.Errorf("invalid url %s in sitemap %s: %v", loc, location, err)
+		}
+		if err = fn(req); err != nil {
+			return err
+		}
+	}
+	if len(doc.Sitemaps) > 0 && depth >= maxSitemapDepth {
+		return fmt.Errorf("sitemap index %s nested too deep", location)
+	}
+	for _, sitemap := range doc.Sitemaps {
+		loc := strings.TrimSpace(sitemap.Loc)
+		if loc == "" {
+			continue
+		}
+		if err = s.walk(loc, depth+1, seen, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sitemapSource) download(location string) (*sitemapDoc, error) {
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sitemap url %s: %v", location, err)
+	}
+	resp, err := s.fetch(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch sitemap %s fail with %v", location, err)
+	}
+	if resp == nil || resp.Body == nil {
+		return nil, fmt.Errorf("fetch sitemap %s with nil response", location)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("fetch sitemap %s with status %d", location, resp.StatusCode)
+	}
+	var body io.Reader = io.LimitReader(resp.Body, maxSitemapSize)
+	//压缩的站点地图一般以 .gz 结尾，已经被传输层解压的不需要再处理
+	if strings.HasSuffix(strings.ToLower(req.URL.Path), ".gz") && !resp.Uncompressed {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("decompress sitemap %s fail with %v", location, err)
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, maxSitemapSize)
+	}
+	var doc sitemapDoc
+	if err = xml.NewDecoder(body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse sitemap %s fail with %v", location, err)
+	}
+	return &doc, nil
+}
+
+// FromSitemap 从站点地图中读取链接，支持站点地图索引与gzip压缩
+// fetch为空时使用http.DefaultClient下载
+func FromSitemap(location string, fetch FetchFunc) Source {
+	if fetch == nil {
+		fetch = http.DefaultClient.Do
+	}
+	return &sitemapSource{location: location, fetch: fetch}
+}
@@ -0,0 +1,266 @@
+package session
+
+import (
+	"Gure/gerror"
+	"Gure/module"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSlot 未指定会话时使用的会话名称
+const DefaultSlot = "default"
+
+// fileSuffix 会话文件的后缀，文件名为转义后的会话名称
+const fileSuffix = ".cookies.json"
+
+// Store 一次爬取的Cookie存储，按照会话划分，要求并发安全
+type Store interface {
+	module.CookieJars
+
+	// SetCookies 向会话写入Cookie，可以在启动之前预先设置登录状态
+	SetCookies(slot string, u *url.URL, cookies []*http.Cookie)
+
+	// Cookies 返回会话中发送到u的Cookie
+	Cookies(slot string, u *url.URL) []*http.Cookie
+
+	// Slots 返回所有会话名称
+	Slots() []string
+
+	// Save 将有变化的会话写入目录，没有目录时不做处理
+	Save() error
+}
+
+// Login 登录请求，调度器启动时在第一个种子之前使用会话下载
+type Login struct {
+	//Slot 登录的会话
+	Slot string
+	//Request 登录请求，例如提交表单的POST请求
+	Request *http.Request
+	//Check 检查登录响应，为空时只要求状态码小于400
+	Check func(resp *http.Response) error
+}
+
+// slotKey 保存会话名称的context键
+type slotKey struct{}
+
+// WithSlot 返回属于指定会话的种子请求
+func WithSlot(req *http.Request, slot string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), slotKey{}, slot))
+}
+
+// SlotOf 返回种子请求所属的会话，没有指定时为空
+func SlotOf(req *http.Request) string {
+	slot, _ := req.Context().Value(slotKey{}).(string)
+	return slot
+}
+
+// cookieEntry 保存到文件中的一条Cookie，MaxAge已经转换为Expires
+type cookieEntry struct {
+	URL    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+// persistentJar 记录写入的Cookie以便保存的Cookie存储
+type persistentJar struct {
+	jar     *cookiejar.Jar
+	lock    sync.Mutex
+	entries map[string]cookieEntry
+	//changes 写入的次数，saved 已经保存时的写入次数
+	changes uint64
+	saved   uint64
+}
+
+func newPersistentJar() *persistentJar {
+	jar, _ := cookiejar.New(nil)
+	return &persistentJar{jar: jar, entries: map[string]cookieEntry{}}
+}
+
+func (j *persistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+	now := time.Now()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, cookie := range cookies {
+		stored := *cookie
+		stored.Raw = ""
+		stored.Unparsed = nil
+		if stored.MaxAge > 0 {
+			stored.Expires = now.Add(time.Duration(stored.MaxAge) * time.Second)
+			stored.MaxAge = 0
+		}
+		domain := strings.ToLower(strings.TrimPrefix(stored.Domain, "."))
+		if domain == "" {
+			domain = u.Hostname()
+		}
+		key := domain + ";" + stored.Path + ";" + stored.Name
+		if stored.MaxAge < 0 || (!stored.Expires.IsZero() && !stored.Expires.After(now)) {
+			delete(j.entries, key)
+		} else {
+			j.entries[key] = cookieEntry{URL: u.String(), Cookie: &stored}
+		}
+		j.changes++
+	}
+}
+
+func (j *persistentJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// load 重新写入文件中未过期的Cookie
+func (j *persistentJar) load(entries []cookieEntry) {
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.Cookie == nil || (!entry.Cookie.Expires.IsZero() && !entry.Cookie.Expires.After(now)) {
+			continue
+		}
+		u, err := url.Parse(entry.URL)
+		if err != nil {
+			continue
+		}
+		j.SetCookies(u, []*http.Cookie{entry.Cookie})
+	}
+	j.saved = j.changes
+}
+
+// snapshot 返回有变化时需要保存的Cookie以及对应的写入次数
+func (j *persistentJar) snapshot() ([]cookieEntry, uint64, bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.changes == j.saved {
+		return nil, 0, false
+	}
+	keys := make([]string, 0, len(j.entries))
+	for key := range j.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := make([]cookieEntry, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, j.entries[key])
+	}
+	return entries, j.changes, true
+}
+
+// markSaved 保存成功后记录写入次数，保存失败时下次重新保存
+func (j *persistentJar) markSaved(changes uint64) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if changes > j.saved {
+		j.saved = changes
+	}
+}
+
+type gureStore struct {
+	dir   string
+	lock  sync.Mutex
+	slots map[string]*persistentJar
+}
+
+// New 创建Cookie存储，dir不为空时从中读取之前保存的会话，Save时写回
+//dir为空时Cookie只保存在内存中
+func New(dir string) (Store, error) {
+	s := &gureStore{dir: dir, slots: map[string]*persistentJar{}}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create cookie dir fail with %v", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+fileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		slot, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(file), fileSuffix))
+		if err != nil {
+			return nil, gerror.NewIllegalParameterError("invalid cookie file " + file)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read cookie file fail with %v", err)
+		}
+		var entries []cookieEntry
+		if err = json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("decode cookie file %s fail with %v", file, err)
+		}
+		jar := newPersistentJar()
+		jar.load(entries)
+		s.slots[slot] = jar
+	}
+	return s, nil
+}
+
+// slot 返回会话的Cookie存储，不存在时创建
+func (s *gureStore) slot(slot string) *persistentJar {
+	if slot == "" {
+		slot = DefaultSlot
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	jar, ok := s.slots[slot]
+	if !ok {
+		jar = newPersistentJar()
+		s.slots[slot] = jar
+	}
+	return jar
+}
+
+func (s *gureStore) Jar(slot string) http.CookieJar {
+	return s.slot(slot)
+}
+
+func (s *gureStore) SetCookies(slot string, u *url.URL, cookies []*http.Cookie) {
+	s.slot(slot).SetCookies(u, cookies)
+}
+
+func (s *gureStore) Cookies(slot string, u *url.URL) []*http.Cookie {
+	return s.slot(slot).Cookies(u)
+}
+
+func (s *gureStore) Slots() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	slots := make([]string, 0, len(s.slots))
+	for slot := range s.slots {
+		slots = append(slots, slot)
+	}
+	sort.Strings(slots)
+	return slots
+}
+
+func (s *gureStore) Save() error {
+	if s.dir == "" {
+		return nil
+	}
+	for _, slot := range s.Slots() {
+		jar := s.slot(slot)
+		entries, changes, changed := jar.snapshot()
+		if !changed {
+			continue
+		}
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return fmt.Errorf("encode cookies of session %s fail with %v", slot, err)
+		}
+		path := filepath.Join(s.dir, url.PathEscape(slot)+fileSuffix)
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err != nil {
+			return fmt.Errorf("write cookie file fail with %v", err)
+		}
+		if err = os.Rename(tmp, path); err != nil {
+			return fmt.Errorf("rename cookie file fail with %v", err)
+		}
+		jar.markSaved(changes)
+	}
+	return nil
+}
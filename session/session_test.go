@@ -0,0 +1,57 @@
+package session
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestStore_Persist(t *testing.T) {
+	dir := t.TempDir()
+	store, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/account")
+	store.SetCookies("alice", u, []*http.Cookie{
+		{Name: "sid", Value: "a", Path: "/", MaxAge: 3600},
+		{Name: "tmp", Value: "x", Path: "/", Expires: time.Now().Add(-time.Hour)},
+	})
+	store.Jar("bob").SetCookies(u, []*http.Cookie{{Name: "sid", Value: "b", Path: "/"}})
+	store.SetCookies("", u, []*http.Cookie{{Name: "theme", Value: "dark", Path: "/"}})
+	if err = store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	//重新打开目录后恢复各个会话
+	restored, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slots := restored.Slots(); len(slots) != 3 || slots[0] != "alice" || slots[1] != "bob" || slots[2] != DefaultSlot {
+		t.Fatalf("unexpected slots %v", slots)
+	}
+	page, _ := url.Parse("https://example.com/page")
+	for slot, want := range map[string]string{"alice": "sid=a", "bob": "sid=b", "": "theme=dark"} {
+		cookies := restored.Cookies(slot, page)
+		if len(cookies) != 1 || cookies[0].String() != want {
+			t.Errorf("session %q got cookies %v, want %s", slot, cookies, want)
+		}
+	}
+
+	//过期的Cookie在保存后被删除
+	restored.SetCookies("alice", u, []*http.Cookie{{Name: "sid", Path: "/", MaxAge: -1}})
+	if err = restored.Save(); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := New(dir)
+	if cookies := again.Cookies("alice", page); len(cookies) != 0 {
+		t.Errorf("expired cookie should be removed, got %v", cookies)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if SlotOf(req) != "" || SlotOf(WithSlot(req, "alice")) != "alice" {
+		t.Errorf("seed request should carry its session")
+	}
+}